@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gordonklaus/ineffassign/pkg/ineffassign"
+	"github.com/kisielk/errcheck/errcheck"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/appends"
+	"golang.org/x/tools/go/analysis/passes/asmdecl"
+	"golang.org/x/tools/go/analysis/passes/assign"
+	"golang.org/x/tools/go/analysis/passes/atomic"
+	"golang.org/x/tools/go/analysis/passes/bools"
+	"golang.org/x/tools/go/analysis/passes/buildtag"
+	"golang.org/x/tools/go/analysis/passes/cgocall"
+	"golang.org/x/tools/go/analysis/passes/composite"
+	"golang.org/x/tools/go/analysis/passes/copylock"
+	"golang.org/x/tools/go/analysis/passes/defers"
+	"golang.org/x/tools/go/analysis/passes/directive"
+	"golang.org/x/tools/go/analysis/passes/errorsas"
+	"golang.org/x/tools/go/analysis/passes/framepointer"
+	"golang.org/x/tools/go/analysis/passes/httpresponse"
+	"golang.org/x/tools/go/analysis/passes/ifaceassert"
+	"golang.org/x/tools/go/analysis/passes/loopclosure"
+	"golang.org/x/tools/go/analysis/passes/lostcancel"
+	"golang.org/x/tools/go/analysis/passes/nilfunc"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/analysis/passes/shadow"
+	"golang.org/x/tools/go/analysis/passes/shift"
+	"golang.org/x/tools/go/analysis/passes/sigchanyzer"
+	"golang.org/x/tools/go/analysis/passes/slog"
+	"golang.org/x/tools/go/analysis/passes/stdmethods"
+	"golang.org/x/tools/go/analysis/passes/stdversion"
+	"golang.org/x/tools/go/analysis/passes/stringintconv"
+	"golang.org/x/tools/go/analysis/passes/structtag"
+	"golang.org/x/tools/go/analysis/passes/testinggoroutine"
+	"golang.org/x/tools/go/analysis/passes/tests"
+	"golang.org/x/tools/go/analysis/passes/timeformat"
+	"golang.org/x/tools/go/analysis/passes/unmarshal"
+	"golang.org/x/tools/go/analysis/passes/unreachable"
+	"golang.org/x/tools/go/analysis/passes/unsafeptr"
+	"golang.org/x/tools/go/analysis/passes/unusedresult"
+	"golang.org/x/tools/go/packages"
+	sclint "honnef.co/go/tools/analysis/lint"
+	"honnef.co/go/tools/simple"
+	"honnef.co/go/tools/staticcheck"
+	"honnef.co/go/tools/stylecheck"
+	"honnef.co/go/tools/unused"
+)
+
+const analysisPrefix = "analysis"
+
+// vetAnalyzers returns the analyzers run by go vet.
+func vetAnalyzers() []*analysis.Analyzer {
+	return []*analysis.Analyzer{
+		appends.Analyzer,
+		asmdecl.Analyzer,
+		assign.Analyzer,
+		atomic.Analyzer,
+		bools.Analyzer,
+		buildtag.Analyzer,
+		cgocall.Analyzer,
+		composite.Analyzer,
+		copylock.Analyzer,
+		defers.Analyzer,
+		directive.Analyzer,
+		errorsas.Analyzer,
+		framepointer.Analyzer,
+		httpresponse.Analyzer,
+		ifaceassert.Analyzer,
+		loopclosure.Analyzer,
+		lostcancel.Analyzer,
+		nilfunc.Analyzer,
+		printf.Analyzer,
+		shift.Analyzer,
+		sigchanyzer.Analyzer,
+		slog.Analyzer,
+		stdmethods.Analyzer,
+		stdversion.Analyzer,
+		stringintconv.Analyzer,
+		structtag.Analyzer,
+		testinggoroutine.Analyzer,
+		tests.Analyzer,
+		timeformat.Analyzer,
+		unmarshal.Analyzer,
+		unreachable.Analyzer,
+		unsafeptr.Analyzer,
+		unusedresult.Analyzer,
+	}
+}
+
+// applyVetFlags configures the go vet analyzers according to the flags given
+// with --vet-flag, returning the analyzers that remain enabled. As with go
+// vet, enabling any analyzer explicitly disables those not also enabled, while
+// analyzer-specific flags, such as -printf.funcs=Log, are set on the analyzer.
+// Flags that don't apply to an analyzer, such as build flags, are rejected,
+// since they can't be honored when running in-process.
+func applyVetFlags(analyzers []*analysis.Analyzer, flags []string) ([]*analysis.Analyzer, error) {
+	byName := make(map[string]*analysis.Analyzer, len(analyzers))
+	for _, a := range analyzers {
+		byName[a.Name] = a
+	}
+	enabled := make(map[string]bool)
+	explicitlyEnabled := false
+	for _, flag := range flags {
+		name := strings.TrimLeft(flag, "-")
+		value := "true"
+		if i := strings.IndexByte(name, '='); i != -1 {
+			name, value = name[:i], name[i+1:]
+		}
+		if i := strings.IndexByte(name, '.'); i != -1 {
+			a, ok := byName[name[:i]]
+			if !ok || a.Flags.Lookup(name[i+1:]) == nil {
+				return nil, fmt.Errorf("The vet flag %s is not supported by the in-process analyzers", flag)
+			}
+			if err := a.Flags.Set(name[i+1:], value); err != nil {
+				return nil, fmt.Errorf("Invalid vet flag %s: %v", flag, err)
+			}
+			continue
+		}
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("The vet flag %s is not supported by the in-process analyzers", flag)
+		}
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid vet flag %s: %v", flag, err)
+		}
+		enabled[name] = on
+		if on {
+			explicitlyEnabled = true
+		}
+	}
+	result := make([]*analysis.Analyzer, 0, len(analyzers))
+	for _, a := range analyzers {
+		on, ok := enabled[a.Name]
+		if (ok && on) || (!ok && !explicitlyEnabled) {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+// staticcheckAnalyzers returns the analyzers matching the checks the
+// staticcheck linter is configured to run.
+func staticcheckAnalyzers() []*analysis.Analyzer {
+	excluded := map[string]bool{"ST1000": true, "ST1005": true}
+	var result []*analysis.Analyzer
+	for _, set := range [][]*sclint.Analyzer{staticcheck.Analyzers, simple.Analyzers, stylecheck.Analyzers, {unused.Analyzer}} {
+		for _, one := range set {
+			if !excluded[one.Analyzer.Name] {
+				result = append(result, one.Analyzer)
+			}
+		}
+	}
+	return result
+}
+
+var configureErrcheckOnce sync.Once
+
+// errcheckAnalyzers returns the errcheck analyzer, configured to match the
+// arguments the errcheck linter is run with. The configuration lives in
+// package-level state within errcheck, so it is only applied once.
+func errcheckAnalyzers() []*analysis.Analyzer {
+	configureErrcheckOnce.Do(func() {
+		errcheck.DefaultExcludedSymbols = append(errcheck.DefaultExcludedSymbols,
+			"github.com/richardwilkes/errs.Append",
+			"github.com/richardwilkes/toolbox/errs.Append",
+			"(*io.PipeReader).CloseWithError",
+			"(*io.PipeWriter).CloseWithError",
+		)
+		errcheck.Analyzer.Flags.Set("blank", "true")  // @allow
+		errcheck.Analyzer.Flags.Set("assert", "true") // @allow
+	})
+	return []*analysis.Analyzer{errcheck.Analyzer}
+}
+
+func shadowAnalyzers() []*analysis.Analyzer {
+	return []*analysis.Analyzer{shadow.Analyzer}
+}
+
+func ineffassignAnalyzers() []*analysis.Analyzer {
+	return []*analysis.Analyzer{ineffassign.Analyzer}
+}
+
+// inProcessLinters splits the linters into those that will be run in-process
+// and those that must still be run as separate processes.
+func (l *lint) inProcessLinters() (inProcess, external []linter) {
+	for _, one := range l.linters {
+		if l.inProcess && one.analyzers != nil {
+			inProcess = append(inProcess, one)
+		} else {
+			external = append(external, one)
+		}
+	}
+	return inProcess, external
+}
+
+// runAnalyzers loads the packages once and then runs the analyzers provided
+// by the linters, along with the disallow rules, in a single pass, sharing
+// facts between them.
+func (l *lint) runAnalyzers(ctx context.Context, linters []linter, includeDisallow bool) {
+	owner := make(map[*analysis.Analyzer]string)
+	var analyzers []*analysis.Analyzer
+	for _, one := range linters {
+		list := one.analyzers()
+		if one.Name() == "vet" {
+			var err error
+			if list, err = applyVetFlags(list, l.vetFlags); err != nil {
+				l.lineChan <- problem{prefix: one.Name(), output: err.Error()}
+				l.markError()
+				continue
+			}
+		}
+		for _, a := range list {
+			if _, exists := owner[a]; !exists {
+				owner[a] = one.Name()
+				analyzers = append(analyzers, a)
+			}
+		}
+	}
+	if includeDisallow {
+		a := l.disallowAnalyzer()
+		owner[a] = disallowPrefix
+		analyzers = append(analyzers, a)
+	}
+	if len(analyzers) == 0 {
+		return
+	}
+	if l.dryRun {
+		names := make([]string, 0, len(linters))
+		for _, one := range linters {
+			names = append(names, one.Name())
+		}
+		if includeDisallow {
+			names = append(names, disallowPrefix)
+		}
+		l.lineChan <- problem{output: fmt.Sprintf("%s (in-process): %s", analysisPrefix, strings.Join(names, ", "))}
+		return
+	}
+	pkgs, err := packages.Load(&packages.Config{Context: ctx, Mode: packages.LoadAllSyntax, Dir: l.repoPath, Tests: true}, l.pkgs...)
+	if err != nil {
+		l.lineChan <- problem{prefix: analysisPrefix, output: err.Error()}
+		l.markError()
+		return
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, one := range pkg.Errors {
+			l.lineChan <- problem{prefix: analysisPrefix, output: one.Error()}
+		}
+	})
+	graph, err := checker.Analyze(analyzers, pkgs, nil)
+	if err != nil && graph == nil {
+		l.lineChan <- problem{prefix: analysisPrefix, output: err.Error()}
+		l.markError()
+		return
+	}
+	// With tests included, a package's files are analyzed both on their own
+	// and as part of its test variant, so duplicate findings are dropped.
+	seen := make(map[problem]bool)
+	for act := range graph.All() {
+		if !act.IsRoot {
+			continue
+		}
+		prefix := owner[act.Analyzer]
+		if act.Err != nil {
+			l.lineChan <- problem{prefix: prefix, output: fmt.Sprintf("%s: %v", act.Package.PkgPath, act.Err)}
+			continue
+		}
+		files := make(map[string]*ast.File)
+		for _, f := range act.Package.Syntax {
+			files[act.Package.Fset.File(f.Pos()).Name()] = f
+		}
+		for _, d := range act.Diagnostics {
+			pos := act.Package.Fset.Position(d.Pos)
+			if f, ok := files[pos.Filename]; ok && allowedOnLine(act.Package.Fset, f, d.Pos) {
+				continue
+			}
+			msg := d.Message
+			if act.Analyzer.Name != prefix {
+				msg = fmt.Sprintf("%s (%s)", msg, act.Analyzer.Name)
+			}
+			p := problem{prefix: prefix, output: fmt.Sprintf("%v: %s", pos, msg)}
+			if !seen[p] {
+				seen[p] = true
+				l.lineChan <- p
+			}
+		}
+	}
+}
+
+// disallowAnalyzer returns an analyzer that applies the disallow rules.
+func (l *lint) disallowAnalyzer() *analysis.Analyzer {
+	imports, functions := l.disallowedSets()
+	return &analysis.Analyzer{
+		Name: disallowPrefix,
+		Doc:  "reports uses of disallowed imports and functions",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				checkFileDisallowed(pass.Fset, f, imports, functions, func(pos token.Pos, msg string) {
+					pass.Reportf(pos, "%s", msg)
+				})
+			}
+			return nil, nil
+		},
+	}
+}
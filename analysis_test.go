@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestApplyVetFlags(t *testing.T) {
+	all := vetAnalyzers()
+	for _, one := range []struct {
+		flags   []string
+		count   int
+		invalid bool
+	}{
+		{count: len(all)},
+		{flags: []string{"-composites=false"}, count: len(all) - 1},
+		{flags: []string{"-composites=false", "--printf=false"}, count: len(all) - 2},
+		{flags: []string{"-printf"}, count: 1},
+		{flags: []string{"-printf=true", "-composites"}, count: 2},
+		{flags: []string{"-printf", "-printf=false"}, count: 0},
+		{flags: []string{"-tags=foo"}, invalid: true},
+		{flags: []string{"-composites=maybe"}, invalid: true},
+		{flags: []string{"-printf.nosuchflag=x"}, invalid: true},
+		{flags: []string{"-nosuchanalyzer.funcs=Log"}, invalid: true},
+	} {
+		result, err := applyVetFlags(all, one.flags)
+		if one.invalid {
+			if err == nil {
+				t.Errorf("%v: expected an error", one.flags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", one.flags, err)
+		} else if len(result) != one.count {
+			t.Errorf("%v: expected %d analyzers, got %d", one.flags, one.count, len(result))
+		}
+	}
+}
@@ -1,39 +1,54 @@
 package main
 
 import (
-	"archive/zip"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/richardwilkes/toolbox/cmdline"
 	"github.com/richardwilkes/toolbox/xio"
+	"github.com/richardwilkes/toolbox/xio/fs"
 	"github.com/richardwilkes/toolbox/xio/fs/safe"
+	"golang.org/x/mod/semver"
 )
 
-// Archive creates an archive of the required linters.
-func Archive(goos, goarch string) (err error) {
+// Archive creates an archive of the required linters, built for each of the
+// platforms, which are specified as "goos/goarch", and written in the
+// specified format. If includeSelf is set, dirt itself is also included. If
+// signKey is set, the archive's manifest is signed with the ed25519 private key
+// found there.
+func Archive(platforms []string, format, signKey string, includeSelf bool) (err error) {
+	var key ed25519.PrivateKey
+	if signKey != "" {
+		if key, err = loadPrivateKey(signKey); err != nil {
+			return err
+		}
+	}
+	if _, err = newArchiveWriter(format, ioutil.Discard); err != nil {
+		return err
+	}
+	var manifest archiveManifest
+	if manifest.Platforms, err = parsePlatforms(platforms); err != nil {
+		return err
+	}
 	var tmpDir string
 	tmpDir, err = ioutil.TempDir(os.TempDir(), cmdline.AppCmdName)
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(tmpDir) // @allow
-	if goos == "" {
-		goos = runtime.GOOS
-	}
-	if goarch == "" {
-		goarch = runtime.GOARCH
+	name := fmt.Sprintf("%s-linters-%s-multi.%s", cmdline.AppCmdName, runtime.Version(), format)
+	if len(manifest.Platforms) == 1 {
+		name = fmt.Sprintf("%s-linters-%s-%s-%s.%s", cmdline.AppCmdName, runtime.Version(), manifest.Platforms[0].GOOS, manifest.Platforms[0].GOARCH, format)
 	}
 	var f *safe.File
-	f, err = safe.Create(fmt.Sprintf("%s-linters-%s-%s-%s.zip", cmdline.AppCmdName, runtime.Version(), goos, goarch))
+	f, err = safe.Create(name)
 	if err != nil {
 		return err
 	}
@@ -42,152 +57,208 @@ func Archive(goos, goarch string) (err error) {
 			err = cerr
 		}
 	}()
-	zw := zip.NewWriter(f)
-	gopath, setgopath := os.LookupEnv("GOPATH")
-	for _, one := range selectLinters(false) {
-		if one.pkg != "" {
-			fmt.Printf("Building GOOS=%s GOARCH=%s %s...\n", goos, goarch, one.cmd)
-			one.Install(false)
-			path := filepath.Join(tmpDir, one.cmd)
-			cmd := exec.Command("go", "build", "-o", path, one.pkg)
-			cmd.Env = os.Environ()
-			cmd.Env = append(cmd.Env, "GOOS="+goos, "GOARCH="+goarch)
-			if setgopath {
-				cmd.Env = append(cmd.Env, "GOPATH="+gopath)
+	var aw archiveWriter
+	if aw, err = newArchiveWriter(format, f); err != nil {
+		return err
+	}
+	for i := range manifest.Platforms {
+		platform := &manifest.Platforms[i]
+		buildDir := filepath.Join(tmpDir, platform.dir())
+		for j := range Linters {
+			one := &Linters[j]
+			if one.pkg != "" {
+				fmt.Printf("Building GOOS=%s GOARCH=%s %s...\n", platform.GOOS, platform.GOARCH, one.cmd)
+				var path string
+				if path, err = one.build(platform.GOOS, platform.GOARCH, buildDir); err != nil {
+					return err
+				}
+				var tool archiveTool
+				if tool, err = newArchiveTool(one, path, platform.dir()+"/"+filepath.Base(path)); err != nil {
+					return err
+				}
+				platform.Tools = append(platform.Tools, tool)
+				if err = addFileToArchive(aw, path, tool.File); err != nil {
+					return err
+				}
 			}
-			var data []byte
-			if data, err = cmd.CombinedOutput(); err != nil {
-				err = fmt.Errorf("Unable to build %s\n%s", one.Name(), string(data))
+		}
+		if includeSelf {
+			fmt.Printf("Building GOOS=%s GOARCH=%s %s...\n", platform.GOOS, platform.GOARCH, cmdline.AppCmdName)
+			var selfPath string
+			if selfPath, manifest.DirtVersion, err = buildSelf(platform.GOOS, platform.GOARCH, buildDir); err != nil {
 				return err
 			}
-			if err = copyFileToZip(path, zw); err != nil {
+			var self archiveTool
+			if self, err = newArchiveTool(&linter{cmd: cmdline.AppCmdName}, selfPath, platform.dir()+"/"+filepath.Base(selfPath)); err != nil {
 				return err
 			}
+			platform.Self = &self
+			if err = addFileToArchive(aw, selfPath, self.File); err != nil {
+				return err
+			}
+		}
+	}
+	var data []byte
+	if data, err = json.MarshalIndent(&manifest, "", "  "); err != nil {
+		return err
+	}
+	if err = addDataToArchive(aw, manifestName, data); err != nil {
+		return err
+	}
+	if key != nil {
+		if err = addDataToArchive(aw, signatureName, signManifest(key, data)); err != nil {
+			return err
 		}
 	}
-	if err = zw.Close(); err != nil {
+	if err = aw.Close(); err != nil {
 		return err
 	}
 	err = f.Commit()
 	return err
 }
 
-func copyFileToZip(fromPath string, to *zip.Writer) error {
-	in, err := os.Open(fromPath)
-	if err != nil {
-		return err
+// reproducibleBuildFlags trim file system paths and use fixed linker flags so
+// that the same inputs always produce the same binary.
+var reproducibleBuildFlags = []string{"-trimpath", "-ldflags=-s -w -buildid="}
+
+// crossBuildEnv returns the environment for building a binary for the
+// specified platform.
+func crossBuildEnv(goos, goarch string) []string {
+	return append(goEnv(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+}
+
+// exeName returns the file name of the command's binary on goos.
+func exeName(cmd, goos string) string {
+	if goos == "windows" {
+		return cmd + ".exe"
+	}
+	return cmd
+}
+
+// build builds the linter's pinned version for the specified platform,
+// returning the path to the resulting binary. A scratch GOPATH within tmpDir
+// is used so that binaries for other platforms don't end up in the real one.
+func (lntr *linter) build(goos, goarch, tmpDir string) (string, error) {
+	if !activeToolchain().supportsModuleInstall() {
+		return "", fmt.Errorf("Building %s requires go1.16 or later, but the active toolchain is %s", lntr.Name(), goVersion())
+	}
+	target := "latest"
+	if lntr.version != "" {
+		target = lntr.version
 	}
-	defer xio.CloseIgnoringErrors(in)
-	info, err := in.Stat()
+	gopath := filepath.Join(tmpDir, "gopath")
+	cmd := exec.Command("go", append(append([]string{"install"}, reproducibleBuildFlags...), lntr.pkg+"@"+target)...)
+	cmd.Env = append(crossBuildEnv(goos, goarch), "GOPATH="+gopath, "GOBIN=", "GOMODCACHE="+activeToolchain().GOMODCACHE)
+	if data, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("Unable to build %s\n%s", lntr.Name(), string(data))
+	}
+	name := exeName(lntr.cmd, goos)
+	// go install places cross-compiled binaries into a platform-specific
+	// subdirectory.
+	for _, dir := range []string{filepath.Join(gopath, "bin", goos+"_"+goarch), filepath.Join(gopath, "bin")} {
+		if path := filepath.Join(dir, name); fs.FileExists(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("Unable to locate the binary built for %s", lntr.Name())
+}
+
+// InstallFromArchive attempts to install the linters from an archive, which
+// is retrieved from the first of the sources that can supply it. If any
+// trusted public keys are specified, the archive's manifest must carry a valid
+// signature from one of them before anything is extracted.
+func InstallFromArchive(sources, trustKeys []string, dlOpts downloadOptions) error {
+	keys := make([]ed25519.PublicKey, 0, len(trustKeys))
+	for _, one := range trustKeys {
+		key, err := loadPublicKey(one)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	binPath, err := ensureBinPath()
 	if err != nil {
 		return err
 	}
-	header, err := zip.FileInfoHeader(info)
+	archivePath, err := fetchArchive(sources, dlOpts)
 	if err != nil {
 		return err
 	}
-	header.Method = zip.Deflate
-	out, err := to.CreateHeader(header)
+	ar, err := openArchive(archivePath)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(out, in)
-	return err
-}
-
-// InstallFromArchive attempts to install the linters from an archive.
-func InstallFromArchive(url string) error {
-	path, err := ensureBinPath()
+	defer xio.CloseIgnoringErrors(ar)
+	manifest, err := readArchiveManifest(ar)
 	if err != nil {
 		return err
 	}
-	var archivePath string
-	lower := strings.ToLower(url)
-	if strings.HasPrefix(lower, "http:") || strings.HasPrefix(lower, "https:") {
-		var f *os.File
-		f, err = ioutil.TempFile(path, cmdline.AppCmdName)
-		if err != nil {
-			return err
-		}
-		archivePath = f.Name()
-		defer os.Remove(archivePath) // @allow
-		err = downloadArchive(url, f)
-		if err != nil {
-			return err
-		}
-		if err = f.Close(); err != nil {
+	if len(keys) > 0 {
+		if err = manifest.verifySignature(ar, keys); err != nil {
 			return err
 		}
-	} else {
-		archivePath = url
 	}
-	linters := selectLinters(false)
-	zr, err := zip.OpenReader(archivePath)
-	if err != nil {
+	platform := manifest.platform(runtime.GOOS, runtime.GOARCH)
+	if platform == nil {
+		return fmt.Errorf("The archive contains linters for %s, but this machine requires %s/%s", manifest.platformList(), runtime.GOOS, runtime.GOARCH)
+	}
+	if err = platform.verify(ar); err != nil {
 		return err
 	}
-	defer xio.CloseIgnoringErrors(zr)
-	for _, f := range zr.File {
-		for _, linter := range linters {
-			if linter.pkg != "" && f.Name == linter.cmd {
-				if err = copyFileFromZip(f, filepath.Join(path, linter.cmd)); err != nil {
-					return err
-				}
-				fmt.Println("Installed", linter.Name(), "from archive")
-				break
+	for _, tool := range platform.Tools {
+		lntr := findLinter(tool.Name)
+		if lntr == nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping unknown linter %s in archive\n", tool.Name)
+			continue
+		}
+		var name string
+		if name, err = installName(tool.File); err != nil {
+			return err
+		}
+		dir := binPath
+		if lntr.version != "" {
+			if !semver.IsValid(tool.Version) {
+				return fmt.Errorf("The archive contains an invalid version of %s: %q", tool.Name, tool.Version)
+			}
+			if tool.Version != lntr.version {
+				fmt.Fprintf(os.Stderr, "Warning: the archive contains version %s of %s, but version %s is pinned\n", tool.Version, tool.Name, lntr.version)
+			}
+			archived := *lntr
+			archived.version = tool.Version
+			if dir, err = archived.toolDir(); err != nil {
+				return err
+			}
+			if err = os.MkdirAll(dir, 0755); err != nil {
+				return err
 			}
 		}
-	}
-	return nil
-}
-
-func ensureBinPath() (string, error) {
-	var path string
-	paths := filepath.SplitList(os.Getenv("GOPATH"))
-	if len(paths) == 0 {
-		dir, err := homedir.Dir()
-		if err != nil {
-			return "", err
+		if err = copyFileFromArchive(ar, tool.File, filepath.Join(dir, name)); err != nil {
+			return err
 		}
-		path = filepath.Join(dir, "go")
-	} else {
-		path = paths[0]
+		fmt.Println("Installed", tool.Name, tool.Version, "from archive")
 	}
-	path = filepath.Join(path, "bin")
-	if err := os.MkdirAll(path, 0755); err != nil {
-		return "", err
-	}
-	return path, nil
+	return nil
 }
 
-func downloadArchive(url string, w io.Writer) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+// installName returns the name a binary found at file within an archive is
+// installed as, which is the last element of its slash-separated path. An
+// error is returned if that name could refer to a location outside of the
+// directory it is installed into on any platform.
+func installName(file string) (string, error) {
+	name := file[strings.LastIndexByte(file, '/')+1:]
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\:`) || filepath.Base(name) != name {
+		return "", fmt.Errorf("The archive contains an invalid file name: %q", file)
 	}
-	defer xio.CloseIgnoringErrors(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unable to retrieve archive from %s : %s", url, resp.Status)
-	}
-	_, err = io.Copy(w, resp.Body)
-	return err
+	return name, nil
 }
 
-func copyFileFromZip(f *zip.File, dstPath string) error {
-	r, err := f.Open()
+func ensureBinPath() (string, error) {
+	path, err := activeToolchain().binDir()
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer xio.CloseIgnoringErrors(r)
-	w, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return err
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return "", err
 	}
-	defer func() {
-		if cerr := w.Close(); cerr != nil && err == nil {
-			err = cerr
-		}
-	}()
-	_, err = io.Copy(w, r)
-	return err
+	return path, nil
 }
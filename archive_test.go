@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestInstallName(t *testing.T) {
+	for _, one := range []struct {
+		file string
+		name string
+	}{
+		{file: "linux_amd64/staticcheck", name: "staticcheck"},
+		{file: "windows_amd64/staticcheck.exe", name: "staticcheck.exe"},
+		{file: "staticcheck", name: "staticcheck"},
+		{file: `windows_amd64/..\..\evil.exe`},
+		{file: `..\evil.exe`},
+		{file: `evil\x.exe`},
+		{file: "linux_amd64/.."},
+		{file: "../.."},
+		{file: "linux_amd64/"},
+		{file: ""},
+		{file: "/"},
+		{file: "C:evil.exe"},
+		{file: "linux_amd64/..evil"},
+	} {
+		name, err := installName(one.file)
+		if one.name == "" {
+			if err == nil {
+				t.Errorf("installName(%q) returned %q, but should have been rejected", one.file, name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("installName(%q) failed: %v", one.file, err)
+		} else if name != one.name {
+			t.Errorf("installName(%q) returned %q, expected %q", one.file, name, one.name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio"
+	"github.com/richardwilkes/toolbox/xio/fs"
+)
+
+type archiveCmd struct {
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *archiveCmd) Name() string {
+	return "archive"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *archiveCmd) Usage() string {
+	return "Work with linter archives created by --archive."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *archiveCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	cl.AddCommand(&archiveInspectCmd{})
+	cl.AddCommand(&archiveKeygenCmd{})
+	if remaining := cl.Parse(args); len(remaining) > 0 {
+		return cl.RunCommand(remaining)
+	}
+	cl.DisplayUsage()
+	return nil
+}
+
+type archiveInspectCmd struct {
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *archiveInspectCmd) Name() string {
+	return "inspect"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *archiveInspectCmd) Usage() string {
+	return "Print the manifest of a linter archive."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *archiveInspectCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	cl.UsageSuffix = "<archive>"
+	remaining := cl.Parse(args)
+	if len(remaining) != 1 {
+		return errors.New("An archive file must be specified")
+	}
+	ar, err := openArchive(remaining[0])
+	if err != nil {
+		return err
+	}
+	defer xio.CloseIgnoringErrors(ar)
+	manifest, err := readArchiveManifest(ar)
+	if err != nil {
+		return err
+	}
+	signed := "no"
+	if ar.has(signatureName) {
+		signed = "yes"
+	}
+	fmt.Printf("Signed: %s\n", signed)
+	if manifest.DirtVersion != "" {
+		fmt.Printf("Includes %s: %s\n", cmdline.AppCmdName, manifest.DirtVersion)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, platform := range manifest.Platforms {
+		fmt.Fprintf(tw, "\nPlatform: %s/%s\n", platform.GOOS, platform.GOARCH)
+		fmt.Fprintln(tw, "NAME\tFILE\tMODULE\tVERSION\tGO\tSHA256")
+		tools := platform.Tools
+		if platform.Self != nil {
+			tools = append(tools[:len(tools):len(tools)], *platform.Self)
+		}
+		for _, tool := range tools {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", tool.Name, tool.File, tool.Module, tool.Version, tool.GoVersion, tool.SHA256)
+		}
+	}
+	return tw.Flush()
+}
+
+type archiveKeygenCmd struct {
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *archiveKeygenCmd) Name() string {
+	return "keygen"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *archiveKeygenCmd) Usage() string {
+	return "Create an ed25519 key pair for use with --sign-key and --trust-key."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *archiveKeygenCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	cl.UsageSuffix = "<name>"
+	cl.Description = "Creates <name>.key, which holds the private key used with --sign-key, and <name>.pub, which holds the public key used with --trust-key."
+	remaining := cl.Parse(args)
+	if len(remaining) != 1 {
+		return errors.New("A name for the key pair must be specified")
+	}
+	privPath := remaining[0] + ".key"
+	pubPath := remaining[0] + ".pub"
+	for _, one := range []string{privPath, pubPath} {
+		if fs.FileExists(one) {
+			return fmt.Errorf("%s already exists", one)
+		}
+	}
+	private, public, err := generateKeyPair()
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(privPath, private, 0600); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(pubPath, public, 0644); err != nil {
+		return err
+	}
+	fmt.Println("Created", privPath, "and", pubPath)
+	return nil
+}
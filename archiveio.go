@@ -0,0 +1,307 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/richardwilkes/toolbox/xio"
+)
+
+// Supported linter archive formats.
+const (
+	ZipFormat   = "zip"
+	TarGzFormat = "tar.gz"
+)
+
+// archiveTime is the modification time given to every entry within a linter
+// archive, so that archives built from the same inputs are identical.
+var archiveTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveWriter writes entries into a linter archive.
+type archiveWriter interface {
+	add(name string, mode os.FileMode, size int64, r io.Reader) error
+	Close() error
+}
+
+// newArchiveWriter returns an archiveWriter for the format that writes to w.
+func newArchiveWriter(format string, w io.Writer) (archiveWriter, error) {
+	switch format {
+	case ZipFormat:
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}, nil
+	case TarGzFormat:
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	default:
+		return nil, fmt.Errorf("Unknown archive format %s. Use %s or %s", format, ZipFormat, TarGzFormat)
+	}
+}
+
+// addFileToArchive adds the file at fromPath to the archive as name.
+func addFileToArchive(aw archiveWriter, fromPath, name string) error {
+	in, err := os.Open(fromPath)
+	if err != nil {
+		return err
+	}
+	defer xio.CloseIgnoringErrors(in)
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return aw.add(name, 0755, info.Size(), in)
+}
+
+// addDataToArchive adds the data to the archive as name.
+func addDataToArchive(aw archiveWriter, name string, data []byte) error {
+	return aw.add(name, 0644, int64(len(data)), bytes.NewReader(data))
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipArchiveWriter) add(name string, mode os.FileMode, size int64, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: archiveTime,
+	}
+	header.SetMode(mode)
+	out, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarArchiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarArchiveWriter) add(name string, mode os.FileMode, size int64, r io.Reader) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     size,
+		ModTime:  archiveTime,
+		Format:   tar.FormatUSTAR,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// archiveReader provides access to the entries within a linter archive.
+type archiveReader interface {
+	has(name string) bool
+	open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+// openArchive opens the linter archive at archivePath, detecting its format
+// from its contents.
+func openArchive(archivePath string) (archiveReader, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(f, magic)
+	xio.CloseIgnoringErrors(f)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("Unable to read %s: %v", archivePath, err)
+	}
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return openZipArchive(archivePath)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return openTarArchive(archivePath)
+	default:
+		return nil, fmt.Errorf("%s is not a %s or %s archive", archivePath, ZipFormat, TarGzFormat)
+	}
+}
+
+type zipArchiveReader struct {
+	zr    *zip.ReadCloser
+	files map[string]*zip.File
+}
+
+func openZipArchive(archivePath string) (archiveReader, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	r := &zipArchiveReader{zr: zr, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		r.files[f.Name] = f
+	}
+	return r, nil
+}
+
+func (r *zipArchiveReader) has(name string) bool {
+	_, ok := r.files[name]
+	return ok
+}
+
+func (r *zipArchiveReader) open(name string) (io.ReadCloser, error) {
+	f, ok := r.files[name]
+	if !ok {
+		return nil, fmt.Errorf("The archive does not contain %s", name)
+	}
+	return f.Open()
+}
+
+func (r *zipArchiveReader) Close() error {
+	return r.zr.Close()
+}
+
+// tarArchiveReader provides access to the entries of a tar.gz archive. Since
+// the format doesn't allow random access, entries are streamed from the
+// archive as they are opened, restarting from the beginning whenever an entry
+// earlier than the current position is wanted. Nothing is written to disk, so
+// entries may be checked before anything is extracted.
+type tarArchiveReader struct {
+	path  string
+	index map[string]int
+	f     *os.File
+	tr    *tar.Reader
+	next  int
+}
+
+func openTarArchive(archivePath string) (archiveReader, error) {
+	r := &tarArchiveReader{path: archivePath, index: make(map[string]int)}
+	defer xio.CloseIgnoringErrors(r)
+	for {
+		header, err := r.advance()
+		if err != nil {
+			if err == io.EOF {
+				return r, nil
+			}
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("The archive contains an invalid entry name: %s", header.Name)
+		}
+		if _, exists := r.index[name]; exists {
+			return nil, fmt.Errorf("The archive contains more than one %s", name)
+		}
+		r.index[name] = r.next - 1
+	}
+}
+
+// advance moves to the next entry in the archive, opening it if necessary.
+func (r *tarArchiveReader) advance() (*tar.Header, error) {
+	if r.tr == nil {
+		f, err := os.Open(r.path)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			xio.CloseIgnoringErrors(f)
+			return nil, err
+		}
+		r.f = f
+		r.tr = tar.NewReader(gz)
+		r.next = 0
+	}
+	header, err := r.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.next++
+	return header, nil
+}
+
+func (r *tarArchiveReader) has(name string) bool {
+	_, ok := r.index[name]
+	return ok
+}
+
+// open returns the contents of the named entry, which remain readable until
+// the next call to open.
+func (r *tarArchiveReader) open(name string) (io.ReadCloser, error) {
+	target, ok := r.index[name]
+	if !ok {
+		return nil, fmt.Errorf("The archive does not contain %s", name)
+	}
+	if r.tr != nil && target < r.next {
+		if err := r.Close(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if _, err := r.advance(); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("The archive changed while reading %s", name)
+			}
+			return nil, err
+		}
+		if r.next-1 == target {
+			return ioutil.NopCloser(r.tr), nil
+		}
+	}
+}
+
+func (r *tarArchiveReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	r.tr = nil
+	return err
+}
+
+// copyFileFromArchive copies the named entry within the archive to dstPath.
+func copyFileFromArchive(ar archiveReader, name, dstPath string) error {
+	r, err := ar.open(name)
+	if err != nil {
+		return err
+	}
+	defer xio.CloseIgnoringErrors(r)
+	return writeFile(dstPath, r)
+}
+
+func writeFile(dstPath string, r io.Reader) (err error) {
+	w, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	entries := []struct {
+		name string
+		data string
+	}{
+		{name: "linux_amd64/gofmt", data: "gofmt binary"},
+		{name: "linux_amd64/vet", data: "vet binary"},
+		{name: manifestName, data: `{"platforms":[]}`},
+	}
+	for _, format := range []string{ZipFormat, TarGzFormat} {
+		p := filepath.Join(t.TempDir(), "archive."+format)
+		f, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aw, err := newArchiveWriter(format, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, one := range entries {
+			if err = addDataToArchive(aw, one.name, []byte(one.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = aw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ar, err := openArchive(p)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		// Read the last entry first, then the others, to exercise restarting
+		// the stream.
+		for _, i := range []int{2, 0, 1, 0} {
+			if !ar.has(entries[i].name) {
+				t.Fatalf("%s: missing %s", format, entries[i].name)
+			}
+			r, err := ar.open(entries[i].name)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if err = r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != entries[i].data {
+				t.Errorf("%s: %s contained %q, expected %q", format, entries[i].name, data, entries[i].data)
+			}
+		}
+		if ar.has("linux_amd64/missing") {
+			t.Errorf("%s: reported an entry that doesn't exist", format)
+		}
+		if err = ar.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTarArchiveRejectsBadEntries(t *testing.T) {
+	for _, names := range [][]string{
+		{manifestName, manifestName},
+		{"../evil"},
+		{"/etc/evil"},
+	} {
+		p := filepath.Join(t.TempDir(), "archive.tar.gz")
+		f, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz := gzip.NewWriter(f)
+		tw := tar.NewWriter(gz)
+		for _, name := range names {
+			if err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = tw.Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if ar, err := openArchive(p); err == nil {
+			ar.Close() // @allow
+			t.Errorf("an archive containing %v was accepted", names)
+		}
+	}
+}
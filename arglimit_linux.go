@@ -0,0 +1,19 @@
+package main
+
+import "syscall"
+
+// commandLineBudget returns the number of bytes available for the arguments of
+// a new process. Linux allows the arguments and environment together to use a
+// quarter of the stack size limit, but no less than 128KiB and no more than
+// 6MiB.
+func commandLineBudget() int {
+	limit := uint64(6 << 20)
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_STACK, &rlim); err == nil && rlim.Cur/4 < limit {
+		limit = rlim.Cur / 4
+	}
+	if limit < 128<<10 {
+		limit = 128 << 10
+	}
+	return int(limit) - environmentSize()
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+// commandLineBudget returns the number of bytes available for the arguments of
+// a new process, using the smallest ARG_MAX found on the BSDs and macOS.
+func commandLineBudget() int {
+	return 256<<10 - environmentSize()
+}
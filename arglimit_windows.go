@@ -0,0 +1,8 @@
+package main
+
+// commandLineBudget returns the number of bytes available for the arguments of
+// a new process. Windows limits the command line to 32767 characters, while
+// the environment is passed separately.
+func commandLineBudget() int {
+	return 32767
+}
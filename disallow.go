@@ -11,67 +11,86 @@ import (
 const disallowPrefix = "disallow"
 
 func (l *lint) checkDisallowed() {
-	disallowedImports := make(map[string]bool)
+	disallowedImports, disallowedFunctions := l.disallowedSets()
+	hadIssue := false
+	for _, one := range l.files {
+		fset := token.NewFileSet()
+		if f, err := parser.ParseFile(fset, one, nil, parser.ParseComments); err == nil {
+			checkFileDisallowed(fset, f, disallowedImports, disallowedFunctions, func(pos token.Pos, msg string) {
+				hadIssue = true
+				l.lineChan <- problem{prefix: disallowPrefix, output: fmt.Sprintf("%v: %s", fset.Position(pos), msg)}
+			})
+		}
+	}
+	if hadIssue {
+		l.markError()
+	}
+}
+
+func (l *lint) disallowedSets() (disallowedImports, disallowedFunctions map[string]bool) {
+	disallowedImports = make(map[string]bool)
 	for _, one := range l.disallowedImports {
 		disallowedImports[one] = true
 	}
-	disallowedFunctions := make(map[string]bool)
+	disallowedFunctions = make(map[string]bool)
 	for _, one := range l.disallowedFunctions {
 		disallowedFunctions[one] = true
 	}
-	hadIssue := false
-	for _, one := range l.files {
-		fset := token.NewFileSet()
-		if f, err := parser.ParseFile(fset, one, nil, parser.ParseComments); err == nil {
-			if len(disallowedImports) > 0 {
-				for _, imp := range f.Imports {
-					if disallowedImports[strings.Trim(imp.Path.Value, `"`)] {
-						if imp.Comment == nil || !strings.Contains(imp.Comment.Text(), "@allow") {
-							hadIssue = true
-							l.lineChan <- problem{prefix: disallowPrefix, output: fmt.Sprintf("%v: Import of %s not allowed", fset.Position(imp.Pos()), imp.Path.Value)}
-						}
-					}
+	return disallowedImports, disallowedFunctions
+}
+
+// checkFileDisallowed calls report for each use of a disallowed import or
+// function within the file that hasn't been marked with @allow.
+func checkFileDisallowed(fset *token.FileSet, f *ast.File, disallowedImports, disallowedFunctions map[string]bool, report func(pos token.Pos, msg string)) {
+	if len(disallowedImports) > 0 {
+		for _, imp := range f.Imports {
+			if disallowedImports[strings.Trim(imp.Path.Value, `"`)] {
+				if imp.Comment == nil || !strings.Contains(imp.Comment.Text(), "@allow") {
+					report(imp.Pos(), fmt.Sprintf("Import of %s not allowed", imp.Path.Value))
 				}
 			}
-			if len(disallowedFunctions) > 0 {
-				ast.Inspect(f, func(node ast.Node) bool {
-					switch x := node.(type) {
-					case *ast.CallExpr:
-						var name string
-						var pos token.Pos
-						switch c := x.Fun.(type) {
-						case *ast.Ident:
-							name = c.Name
-							pos = c.Pos()
-						case *ast.SelectorExpr:
-							if sx, ok := c.X.(*ast.Ident); ok {
-								name = sx.Name + "."
-							}
-							name += c.Sel.Name
-						}
-						if name != "" {
-							if disallowedFunctions[name] {
-								line := fset.Position(pos).Line
-								ignore := false
-								for _, one := range f.Comments {
-									if line == fset.Position(one.Pos()).Line && strings.Contains(one.Text(), "@allow") {
-										ignore = true
-										break
-									}
-								}
-								if !ignore {
-									hadIssue = true
-									l.lineChan <- problem{prefix: disallowPrefix, output: fmt.Sprintf(`%v: Use of "%s" not allowed`, fset.Position(pos), name)}
-								}
-							}
-						}
-					}
-					return true
-				})
-			}
 		}
 	}
-	if hadIssue {
-		l.markError()
+	if len(disallowedFunctions) > 0 {
+		inspectCalls(f, func(name string, pos token.Pos) {
+			if disallowedFunctions[name] && !allowedOnLine(fset, f, pos) {
+				report(pos, fmt.Sprintf(`Use of "%s" not allowed`, name))
+			}
+		})
+	}
+}
+
+// inspectCalls calls fn for each function call within the file, passing the
+// name of the function as written, e.g. "Println" or "fmt.Println", along
+// with its position.
+func inspectCalls(f *ast.File, fn func(name string, pos token.Pos)) {
+	ast.Inspect(f, func(node ast.Node) bool {
+		if x, ok := node.(*ast.CallExpr); ok {
+			var name string
+			switch c := x.Fun.(type) {
+			case *ast.Ident:
+				name = c.Name
+			case *ast.SelectorExpr:
+				if sx, ok := c.X.(*ast.Ident); ok {
+					name = sx.Name + "."
+				}
+				name += c.Sel.Name
+			}
+			if name != "" {
+				fn(name, x.Fun.Pos())
+			}
+		}
+		return true
+	})
+}
+
+// allowedOnLine returns true if the line containing pos has an @allow comment.
+func allowedOnLine(fset *token.FileSet, f *ast.File, pos token.Pos) bool {
+	line := fset.Position(pos).Line
+	for _, one := range f.Comments {
+		if line == fset.Position(one.Pos()).Line && strings.Contains(one.Text(), "@allow") {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/nightlyone/lockfile"
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio/fs"
+)
+
+// Doctor check statuses.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck holds the result of a single diagnostic check.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctorReport holds the results of all of the diagnostic checks.
+type doctorReport struct {
+	Version string        `json:"version"`
+	OS      string        `json:"os"`
+	Arch    string        `json:"arch"`
+	Checks  []doctorCheck `json:"checks"`
+}
+
+func (r *doctorReport) add(name, status, detail, hint string) {
+	r.Checks = append(r.Checks, doctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+type doctorCmd struct {
+	json bool
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *doctorCmd) Name() string {
+	return "doctor"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *doctorCmd) Usage() string {
+	return "Check the environment dirt runs in and report any problems found, along with hints for fixing them."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *doctorCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	cl.NewBoolOption(&c.json).SetName("json").SetUsage("When set, the report is written as JSON, suitable for attaching to a bug report")
+	cl.Parse(args)
+	report := &doctorReport{Version: cmdline.AppVersion, OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if checkGoToolchain(report) {
+		checkGoPaths(report)
+		checkLinterBinaries(report)
+		root := checkRepoRoot(report)
+		checkGoList(report, root)
+		checkLockFile(report, root)
+	}
+	failed := 0
+	for _, one := range report.Checks {
+		if one.Status == checkFail {
+			failed++
+		}
+	}
+	if c.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, one := range report.Checks {
+			fmt.Printf("[%s] %s: %s\n", strings.ToUpper(one.Status), one.Name, one.Detail)
+			if one.Hint != "" {
+				fmt.Printf("       %s\n", one.Hint)
+			}
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// checkGoToolchain checks that a go toolchain can be found, returning true if
+// it was.
+func checkGoToolchain(report *doctorReport) bool {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		report.add("go", checkFail, "the go command was not found on the PATH", "Install Go from https://go.dev/dl/ and add its bin directory to the PATH")
+		return false
+	}
+	tc := activeToolchain()
+	if tc.err != nil {
+		report.add("go", checkFail, tc.err.Error(), "Check that "+goPath+" runs correctly")
+		return false
+	}
+	detail := fmt.Sprintf("%s at %s, GOROOT=%s", tc.Version, goPath, tc.GOROOT)
+	if tc.GOTOOLCHAIN != "" && tc.GOTOOLCHAIN != "auto" && tc.GOTOOLCHAIN != "local" {
+		detail += ", GOTOOLCHAIN=" + tc.GOTOOLCHAIN
+	}
+	report.add("go", checkPass, detail, "")
+	return true
+}
+
+// checkGoPaths checks GOPATH and GOBIN, and whether the directory go install
+// places binaries into is on the PATH.
+func checkGoPaths(report *doctorReport) {
+	tc := activeToolchain()
+	gobin := tc.GOBIN
+	if gobin == "" {
+		gobin = "(unset)"
+	}
+	detail := fmt.Sprintf("GOPATH=%s, GOBIN=%s", tc.GOPATH, gobin)
+	binDir, err := tc.binDir()
+	if err != nil {
+		report.add("gopath", checkFail, detail+": "+err.Error(), "Set GOPATH or GOBIN")
+		return
+	}
+	for _, one := range filepath.SplitList(os.Getenv("PATH")) {
+		if one != "" && filepath.Clean(one) == filepath.Clean(binDir) {
+			report.add("gopath", checkPass, detail, "")
+			return
+		}
+	}
+	report.add("gopath", checkWarn, detail+": "+binDir+" is not on the PATH", "Pinned linters are run from dirt's tool cache, but unpinned ones installed with go install won't be found unless "+binDir+" is added to the PATH")
+}
+
+// checkLinterBinaries checks the binary each linter uses, along with any
+// different copy found on the PATH.
+func checkLinterBinaries(report *doctorReport) {
+	for i := range Linters {
+		one := &Linters[i]
+		name := "linter " + one.Name()
+		if err := one.CheckToolchain(); err != nil {
+			report.add(name, checkWarn, err.Error(), "Upgrade Go, or use --skip "+one.Name())
+			continue
+		}
+		if one.check != nil {
+			report.add(name, checkPass, "built-in", "")
+			continue
+		}
+		p, err := one.Path()
+		var onPath string
+		if pathCopy, lerr := exec.LookPath(one.cmd); lerr == nil && pathCopy != p {
+			onPath = fmt.Sprintf("; %s on the PATH is version %s", pathCopy, one.binaryVersion(pathCopy))
+		}
+		if err != nil {
+			status := checkWarn
+			hint := "It will be installed on the next run, or run dirt --force-install"
+			if one.pkg == "" {
+				status = checkFail
+				hint = "It is part of the Go distribution, so check the Go installation"
+			}
+			report.add(name, status, "not installed"+onPath, hint)
+			continue
+		}
+		version := one.binaryVersion(p)
+		detail := fmt.Sprintf("%s at %s", version, p)
+		if one.version != "" && version != one.version {
+			report.add(name, checkWarn, fmt.Sprintf("%s, but version %s is pinned%s", detail, one.version, onPath), "Run dirt --reinstall-mismatched")
+			continue
+		}
+		report.add(name, checkPass, detail+onPath, "")
+	}
+}
+
+// checkRepoRoot checks the repo root that would be linted, returning it.
+func checkRepoRoot(report *doctorReport) string {
+	root := findRoot(".")
+	if !fs.IsDir(filepath.Join(root, ".git")) {
+		report.add("repo", checkWarn, "no .git directory was found above the current directory, so "+root+" will be linted", "Run dirt from within a git repository")
+		return root
+	}
+	if !fs.FileExists(filepath.Join(root, "go.mod")) {
+		report.add("repo", checkWarn, root+" has no go.mod", "dirt expects the module to be at the root of the repo")
+		return root
+	}
+	if out, err := exec.Command("go", "env", "GOMOD").Output(); err == nil {
+		if gomod := strings.TrimSpace(string(out)); gomod != "" && gomod != os.DevNull && filepath.Dir(gomod) != root {
+			report.add("repo", checkWarn, fmt.Sprintf("%s will be linted, but the current directory belongs to the module at %s", root, filepath.Dir(gomod)), "Nested modules are linted as part of the repo's root module")
+			return root
+		}
+	}
+	report.add("repo", checkPass, root, "")
+	return root
+}
+
+// checkGoList checks that the packages within the repo can be listed.
+func checkGoList(report *doctorReport, root string) {
+	cmd := exec.Command("go", "list", "./...")
+	cmd.Dir = root
+	cmd.Env = goEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		lines := splitLines(bytes.TrimSpace(out))
+		if len(lines) > 5 {
+			lines = append(lines[:5], "...")
+		}
+		report.add("go list", checkFail, strings.Join(lines, "\n"), "Fix the errors go list reports, e.g. by running go mod download or go mod tidy")
+		return
+	}
+	report.add("go list", checkPass, fmt.Sprintf("%d package(s)", len(splitLines(bytes.TrimSpace(out)))), "")
+}
+
+// checkLockFile checks for a .dirtlock left behind by an invocation using
+// --one.
+func checkLockFile(report *doctorReport, root string) {
+	p := filepath.Join(root, ".dirtlock")
+	if !fs.FileExists(p) {
+		report.add("lock", checkPass, "no "+p, "")
+		return
+	}
+	lf, err := lockfile.New(p)
+	if err != nil {
+		report.add("lock", checkWarn, err.Error(), "")
+		return
+	}
+	owner, err := lf.GetOwner()
+	switch {
+	case err == lockfile.ErrDeadOwner || err == lockfile.ErrInvalidPid:
+		report.add("lock", checkWarn, p+" is stale", "Remove "+p)
+	case err != nil:
+		report.add("lock", checkWarn, fmt.Sprintf("unable to read %s: %v", p, err), "Remove "+p+" if no other dirt is running")
+	default:
+		report.add("lock", checkWarn, fmt.Sprintf("%s is held by process %d", p, owner.Pid), "Another invocation using --one is running; it will be terminated by the next one")
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio"
+	"github.com/richardwilkes/toolbox/xio/fs"
+)
+
+const (
+	// maxRetryDelay is the longest dirt waits between download attempts.
+	maxRetryDelay = 30 * time.Second
+	// maxDownloadAge is how long an unused archive is kept in the download
+	// cache.
+	maxDownloadAge = 30 * 24 * time.Hour
+	// maxPartialAge is how long an abandoned partial download is kept.
+	maxPartialAge = 7 * 24 * time.Hour
+)
+
+// downloadOptions controls how linter archives are retrieved.
+type downloadOptions struct {
+	// timeout is the time allowed for a single download attempt.
+	timeout time.Duration
+	// retries is the number of times a failed download is retried.
+	retries int
+	// checksum, if set, is the expected SHA-256 checksum of the archive.
+	checksum string
+}
+
+// httpStatusError is returned when a server responds with an unexpected
+// status.
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("Unable to retrieve %s: %s", e.url, e.status)
+}
+
+// retryable returns true if the request may succeed if attempted again.
+func (e *httpStatusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code == http.StatusRequestedRangeNotSatisfiable || e.code >= 500
+}
+
+// fetchArchive returns the path to a local copy of the linter archive, trying
+// each of the sources in order until one succeeds. Sources may be http, https
+// or file URLs, or paths, which may start with ~.
+func fetchArchive(sources []string, opts downloadOptions) (string, error) {
+	opts.checksum = strings.ToLower(opts.checksum)
+	if opts.checksum != "" {
+		if p, err := cachedDownload(opts.checksum); err == nil && p != "" {
+			fmt.Println("Using cached archive", p)
+			return p, nil
+		}
+	}
+	var failures []string
+	for _, source := range sources {
+		p, err := fetchOne(source, opts)
+		if err == nil {
+			if perr := pruneDownloads(); perr != nil {
+				fmt.Fprintln(os.Stderr, "Unable to prune the download cache:", perr)
+			}
+			return p, nil
+		}
+		failures = append(failures, err.Error())
+		if len(sources) > 1 {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if len(failures) == 1 {
+		return "", errors.New(failures[0])
+	}
+	return "", fmt.Errorf("Unable to retrieve the archive from any of the %d sources", len(sources))
+}
+
+func fetchOne(source string, opts downloadOptions) (string, error) {
+	lower := strings.ToLower(source)
+	var p string
+	switch {
+	case strings.HasPrefix(lower, "http:") || strings.HasPrefix(lower, "https:"):
+		return download(source, opts)
+	case strings.HasPrefix(lower, "file:"):
+		u, err := url.Parse(source)
+		if err != nil {
+			return "", err
+		}
+		p = u.Path
+		if runtime.GOOS == "windows" {
+			// file:///C:/dir yields a path of /C:/dir
+			p = strings.TrimPrefix(p, "/")
+		}
+		p = filepath.FromSlash(p)
+	default:
+		var err error
+		if p, err = homedir.Expand(source); err != nil {
+			return "", err
+		}
+	}
+	if !fs.FileExists(p) {
+		return "", fmt.Errorf("Unable to locate %s", p)
+	}
+	if opts.checksum != "" {
+		sum, err := fileSHA256(p)
+		if err != nil {
+			return "", err
+		}
+		if sum != opts.checksum {
+			return "", fmt.Errorf("The checksum of %s is %s, but %s was expected", p, sum, opts.checksum)
+		}
+	}
+	return p, nil
+}
+
+// downloadsDir returns the directory holding downloaded archives, keyed by
+// their checksum.
+func downloadsDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cmdline.AppCmdName, "downloads"), nil
+}
+
+// cachedDownload returns the path to the previously downloaded archive with
+// the checksum, or an empty string if there is none.
+func cachedDownload(checksum string) (string, error) {
+	dir, err := downloadsDir()
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, checksum)
+	if !fs.FileExists(p) {
+		return "", nil
+	}
+	sum, err := fileSHA256(p)
+	if err != nil {
+		return "", err
+	}
+	if sum != checksum {
+		// Corrupt, so discard it
+		return "", os.Remove(p)
+	}
+	// Mark it as recently used so that pruning keeps it
+	now := time.Now()
+	os.Chtimes(p, now, now) // @allow
+	return p, nil
+}
+
+// pruneDownloads removes archives that haven't been used recently and
+// abandoned partial downloads from the download cache.
+func pruneDownloads() error {
+	dir, err := downloadsDir()
+	if err != nil {
+		return err
+	}
+	if err = pruneDir(dir, maxDownloadAge); err != nil {
+		return err
+	}
+	return pruneDir(filepath.Join(dir, "partial"), maxPartialAge)
+}
+
+// pruneDir removes the regular files within dir that haven't been modified
+// within maxAge.
+func pruneDir(dir string, maxAge time.Duration) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, fi := range entries {
+		if fi.Mode().IsRegular() && fi.ModTime().Before(cutoff) {
+			if err = os.Remove(filepath.Join(dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// download retrieves the archive at rawURL into the download cache, retrying
+// with exponential backoff and resuming from where a failed attempt left off.
+func download(rawURL string, opts downloadOptions) (string, error) {
+	dir, err := downloadsDir()
+	if err != nil {
+		return "", err
+	}
+	partialDir := filepath.Join(dir, "partial")
+	if err = os.MkdirAll(partialDir, 0755); err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(rawURL))
+	partial := filepath.Join(partialDir, hex.EncodeToString(h[:])+".part")
+	client := &http.Client{
+		Timeout: opts.timeout,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+	}
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		if err = downloadAttempt(client, rawURL, partial); err == nil {
+			break
+		}
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			return "", err
+		}
+		if attempt >= opts.retries {
+			return "", fmt.Errorf("Unable to retrieve %s after %d attempt(s): %v", rawURL, attempt+1, err)
+		}
+		fmt.Fprintf(os.Stderr, "%v. Retrying in %v\n", err, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	sum, err := fileSHA256(partial)
+	if err != nil {
+		return "", err
+	}
+	if opts.checksum != "" && sum != opts.checksum {
+		os.Remove(partial) // @allow
+		return "", fmt.Errorf("The checksum of the archive retrieved from %s is %s, but %s was expected", rawURL, sum, opts.checksum)
+	}
+	p := filepath.Join(dir, sum)
+	if err = os.Rename(partial, p); err != nil {
+		return "", err
+	}
+	os.Remove(validatorPath(partial)) // @allow
+	return p, nil
+}
+
+// validatorPath returns the path of the file holding the validator (the
+// ETag or Last-Modified value) of the response the partial file came from.
+func validatorPath(partial string) string {
+	return strings.TrimSuffix(partial, ".part") + ".validator"
+}
+
+// discardPartial removes the partial file and its validator.
+func discardPartial(partial string) {
+	os.Remove(partial)                // @allow
+	os.Remove(validatorPath(partial)) // @allow
+}
+
+// responseValidator returns the strong validator from the response that can
+// be used with If-Range, or an empty string if there is none.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart returns the first byte position of a Content-Range
+// header value, such as "bytes 100-199/200".
+func contentRangeStart(value string) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, false
+	}
+	value = strings.TrimSpace(value[len("bytes "):])
+	i := strings.IndexByte(value, '-')
+	if i < 1 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(value[:i], 10, 64)
+	if err != nil || start < 0 {
+		return 0, false
+	}
+	return start, true
+}
+
+// downloadAttempt retrieves rawURL into the partial file. If the partial file
+// was left by an earlier attempt and the server supplied a validator for it,
+// the download resumes from its current length, provided the resource hasn't
+// changed since. Otherwise, the download starts over.
+func downloadAttempt(client *http.Client, rawURL, partial string) (err error) {
+	var offset int64
+	var validator string
+	if fi, serr := os.Stat(partial); serr == nil {
+		if data, rerr := ioutil.ReadFile(validatorPath(partial)); rerr == nil {
+			validator = strings.TrimSpace(string(data))
+		}
+		if validator != "" {
+			offset = fi.Size()
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if req.URL.User == nil {
+		if login, password, ok := netrcCredentials(req.URL.Hostname()); ok {
+			req.SetBasicAuth(login, password)
+		}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer xio.CloseIgnoringErrors(resp.Body)
+	flags := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+		if validator = responseValidator(resp); validator != "" {
+			err = ioutil.WriteFile(validatorPath(partial), []byte(validator), 0644)
+		} else {
+			err = os.Remove(validatorPath(partial))
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	case http.StatusPartialContent:
+		if offset == 0 {
+			return &httpStatusError{url: rawURL, status: resp.Status, code: resp.StatusCode}
+		}
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			// The server didn't honor the range as requested, so start over
+			discardPartial(partial)
+			xio.CloseIgnoringErrors(resp.Body)
+			return downloadAttempt(client, rawURL, partial)
+		}
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset == 0 {
+			return &httpStatusError{url: rawURL, status: resp.Status, code: resp.StatusCode}
+		}
+		// The partial file no longer matches what the server has, so start
+		// over.
+		discardPartial(partial)
+		xio.CloseIgnoringErrors(resp.Body)
+		return downloadAttempt(client, rawURL, partial)
+	default:
+		return &httpStatusError{url: rawURL, status: resp.Status, code: resp.StatusCode}
+	}
+	f, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	if offset > 0 {
+		fmt.Printf("Resuming download of %s at %d bytes\n", rawURL, offset)
+	} else {
+		fmt.Println("Downloading", rawURL)
+	}
+	_, err = io.Copy(f, &progressReader{r: resp.Body, done: offset, total: total, next: time.Now().Add(2 * time.Second)})
+	return err
+}
+
+// progressReader periodically reports how much of a download has completed.
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	next  time.Time
+}
+
+func (p *progressReader) Read(buffer []byte) (int, error) {
+	n, err := p.r.Read(buffer)
+	p.done += int64(n)
+	if now := time.Now(); now.After(p.next) {
+		p.next = now.Add(2 * time.Second)
+		if p.total > 0 {
+			fmt.Printf("  %d of %d bytes (%d%%)\n", p.done, p.total, p.done*100/p.total)
+		} else {
+			fmt.Printf("  %d bytes\n", p.done)
+		}
+	}
+	return n, err
+}
+
+// netrcCredentials returns the login and password for host found in the
+// user's .netrc file, which may be relocated with the NETRC environment
+// variable.
+func netrcCredentials(host string) (login, password string, ok bool) {
+	p := os.Getenv("NETRC")
+	if p == "" {
+		dir, err := homedir.Dir()
+		if err != nil {
+			return "", "", false
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		p = filepath.Join(dir, name)
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", "", false
+	}
+	return parseNetrc(data, host)
+}
+
+// parseNetrc returns the login and password for host within the .netrc data,
+// falling back to the default entry if there is one.
+func parseNetrc(data []byte, host string) (login, password string, ok bool) {
+	var tokens []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// Macro definitions end with a blank line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for _, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, field)
+		}
+	}
+	var defLogin, defPassword string
+	hasDefault := false
+	for i := 0; i < len(tokens); i++ {
+		var matches, isDefault bool
+		switch tokens[i] {
+		case "machine":
+			if i+1 >= len(tokens) {
+				return "", "", false
+			}
+			i++
+			matches = tokens[i] == host
+		case "default":
+			isDefault = true
+		default:
+			continue
+		}
+		var entryLogin, entryPassword string
+		for i+2 < len(tokens) && tokens[i+1] != "machine" && tokens[i+1] != "default" {
+			switch tokens[i+1] {
+			case "login":
+				entryLogin = tokens[i+2]
+			case "password":
+				entryPassword = tokens[i+2]
+			}
+			i += 2
+		}
+		if matches {
+			return entryLogin, entryPassword, true
+		}
+		if isDefault {
+			defLogin, defPassword, hasDefault = entryLogin, entryPassword, true
+		}
+	}
+	return defLogin, defPassword, hasDefault
+}
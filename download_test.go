@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var badRange bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if badRange && r.Header.Get("Range") != "" {
+			// Claim partial content, but from the wrong position
+			w.Header().Set("Content-Range", "bytes 0-9/10000")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:10]) // @allow
+			return
+		}
+		http.ServeContent(w, r, "archive.zip", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	client := server.Client()
+	for _, one := range []struct {
+		name      string
+		partial   []byte
+		validator string
+		badRange  bool
+	}{
+		{name: "fresh"},
+		{name: "resume", partial: content[:4000], validator: `"v1"`},
+		{name: "changed", partial: []byte(strings.Repeat("x", 4000)), validator: `"v0"`},
+		{name: "no-validator", partial: []byte(strings.Repeat("x", 4000))},
+		{name: "wrong-range", partial: content[:4000], validator: `"v1"`, badRange: true},
+	} {
+		t.Run(one.name, func(t *testing.T) {
+			badRange = one.badRange
+			partial := filepath.Join(t.TempDir(), "archive.part")
+			if one.partial != nil {
+				if err := ioutil.WriteFile(partial, one.partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if one.validator != "" {
+				if err := ioutil.WriteFile(validatorPath(partial), []byte(one.validator), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := downloadAttempt(client, server.URL+"/archive.zip", partial); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(partial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("downloaded %d bytes that don't match the %d bytes served", len(data), len(content))
+			}
+			if data, err = ioutil.ReadFile(validatorPath(partial)); err != nil || string(data) != `"v1"` {
+				t.Errorf("expected the validator to be recorded, got %q (%v)", data, err)
+			}
+		})
+	}
+}
+
+func TestPruneDir(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old")
+	recent := filepath.Join(dir, "recent")
+	for _, p := range []string{old, recent} {
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	then := time.Now().Add(-2 * maxDownloadAge)
+	if err := os.Chtimes(old, then, then); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneDir(dir, maxDownloadAge); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("the stale file was not pruned")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Error("the recent file was pruned")
+	}
+	if err := pruneDir(filepath.Join(dir, "missing"), maxDownloadAge); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio"
+	"github.com/richardwilkes/toolbox/xio/fs"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	generatePrefix = "generate"
+	generateMarker = "//go:generate "
+)
+
+type generateDirective struct {
+	file string
+	line int
+	text string
+}
+
+// checkGenerated runs the allowed //go:generate directives in a scratch copy
+// of the repo and reports any generated file that differs from the one in
+// the repo.
+func (l *lint) checkGenerated(ctx context.Context) {
+	if len(l.allowedGenerators) == 0 {
+		return
+	}
+	directives := l.findGenerateDirectives()
+	if len(directives) == 0 {
+		return
+	}
+	tmpDir, err := ioutil.TempDir("", cmdline.AppCmdName)
+	if err != nil {
+		l.generateError(err)
+		return
+	}
+	defer os.RemoveAll(tmpDir) // @allow
+	if err = copyRepo(l.repoPath, tmpDir); err != nil {
+		l.generateError(err)
+		return
+	}
+	before, err := snapshotTree(tmpDir)
+	if err != nil {
+		l.generateError(err)
+		return
+	}
+	// producedBy and removedBy record the directive that last wrote or
+	// removed each file
+	producedBy := make(map[string]*generateDirective)
+	removedBy := make(map[string]*generateDirective)
+	for _, d := range directives {
+		var rel string
+		if rel, err = filepath.Rel(l.repoPath, d.file); err != nil {
+			l.generateError(err)
+			return
+		}
+		cmd := exec.CommandContext(ctx, "go", "generate", "-run", "^"+regexp.QuoteMeta(d.text)+"$", filepath.Base(rel))
+		cmd.Dir = filepath.Join(tmpDir, filepath.Dir(rel))
+		var out []byte
+		if out, err = cmd.CombinedOutput(); err != nil {
+			l.lineChan <- problem{prefix: generatePrefix, output: fmt.Sprintf("%s:%d:1: %s", d.file, d.line, bytes.TrimSpace(out))}
+			l.markError()
+			continue
+		}
+		var after map[string]fileState
+		if after, err = snapshotTree(tmpDir); err != nil {
+			l.generateError(err)
+			return
+		}
+		for name, state := range after {
+			if prev, exists := before[name]; !exists || prev != state {
+				producedBy[name] = d
+				delete(removedBy, name)
+			}
+		}
+		for name := range before {
+			if _, exists := after[name]; !exists {
+				removedBy[name] = d
+				delete(producedBy, name)
+			}
+		}
+		before = after
+	}
+	for _, name := range sortedKeys(producedBy) {
+		d := producedBy[name]
+		generated, err := ioutil.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			continue
+		}
+		target := filepath.Join(l.repoPath, name)
+		committed, err := ioutil.ReadFile(target)
+		switch {
+		case err != nil:
+			l.lineChan <- problem{prefix: generatePrefix, output: fmt.Sprintf("%s:%d:1: Generated file %s has not been committed", d.file, d.line, target)}
+		case !bytes.Equal(generated, committed):
+			l.lineChan <- problem{prefix: generatePrefix, output: fmt.Sprintf("%s:%d:1: Generated file %s is out of date", d.file, d.line, target)}
+		default:
+			continue
+		}
+		l.markError()
+	}
+	for _, name := range sortedKeys(removedBy) {
+		d := removedBy[name]
+		target := filepath.Join(l.repoPath, name)
+		if fs.FileExists(target) {
+			l.lineChan <- problem{prefix: generatePrefix, output: fmt.Sprintf("%s:%d:1: File %s is removed when regenerated, but is still committed", d.file, d.line, target)}
+			l.markError()
+		}
+	}
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]*generateDirective) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (l *lint) generateError(err error) {
+	l.lineChan <- problem{prefix: generatePrefix, output: fmt.Sprintf("%s:1:1: %v", l.repoPath, err)}
+	l.markError()
+}
+
+// findGenerateDirectives returns the //go:generate directives within the
+// files being linted whose generator has been allowed.
+func (l *lint) findGenerateDirectives() []*generateDirective {
+	allowed := make(map[string]bool)
+	for _, one := range l.allowedGenerators {
+		allowed[one] = true
+	}
+	var result []*generateDirective
+	for _, file := range l.files {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimRight(scanner.Text(), " \t\r")
+			if strings.HasPrefix(text, generateMarker) {
+				if fields := strings.Fields(text[len(generateMarker):]); len(fields) > 0 {
+					if name, ok := generatorName(fields); ok && allowed[name] {
+						result = append(result, &generateDirective{file: file, line: line, text: text})
+					}
+				}
+			}
+		}
+		xio.CloseIgnoringErrors(f)
+	}
+	return result
+}
+
+// goRunValueFlags holds the "go run" flags that take a value, which may be
+// given as a separate argument.
+var goRunValueFlags = map[string]bool{
+	"asmflags":      true,
+	"buildmode":     true,
+	"compiler":      true,
+	"coverpkg":      true,
+	"covermode":     true,
+	"gccgoflags":    true,
+	"gcflags":       true,
+	"installsuffix": true,
+	"ldflags":       true,
+	"mod":           true,
+	"modfile":       true,
+	"overlay":       true,
+	"p":             true,
+	"pgo":           true,
+	"pkgdir":        true,
+	"tags":          true,
+}
+
+// goRunBoolFlags holds the "go run" flags that don't take a separate value.
+var goRunBoolFlags = map[string]bool{
+	"a":          true,
+	"asan":       true,
+	"buildvcs":   true,
+	"cover":      true,
+	"linkshared": true,
+	"modcacherw": true,
+	"msan":       true,
+	"n":          true,
+	"race":       true,
+	"trimpath":   true,
+	"v":          true,
+	"work":       true,
+	"x":          true,
+}
+
+// generatorName returns the name used to allow a generator. This is the name
+// of the command or, for "go run", the full path of the package being run,
+// without any version. Commands given as a path and "go run" invocations with
+// flags that substitute another program, such as -exec and -toolexec, or that
+// can't be parsed, can't be allowed, in which case false is returned.
+func generatorName(fields []string) (string, bool) {
+	if strings.ContainsAny(fields[0], `$/\`) {
+		return "", false
+	}
+	if fields[0] != "go" || len(fields) < 2 || fields[1] != "run" {
+		return fields[0], true
+	}
+	for i := 2; i < len(fields); i++ {
+		one := fields[i]
+		if !strings.HasPrefix(one, "-") {
+			pkg := strings.SplitN(one, "@", 2)[0]
+			if pkg == "" || strings.Contains(pkg, "$") {
+				return "", false
+			}
+			return pkg, true
+		}
+		name := strings.TrimLeft(one, "-")
+		hasValue := false
+		if j := strings.IndexByte(name, '='); j != -1 {
+			name = name[:j]
+			hasValue = true
+		}
+		switch {
+		case goRunValueFlags[name]:
+			if !hasValue {
+				i++
+			}
+		case goRunBoolFlags[name]:
+		default:
+			// Includes -exec and -toolexec
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// copyRepo copies the repo into the scratch directory. Relative paths within
+// go.mod and go.work files that refer to directories outside of the repo are
+// made absolute, so that they still resolve from the copy.
+func copyRepo(from, to string) error {
+	return filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(to, rel), 0755)
+		}
+		dst := filepath.Join(to, rel)
+		if err = fs.Copy(p, dst); err != nil {
+			return err
+		}
+		switch info.Name() {
+		case "go.mod":
+			return fixModPaths(dst, filepath.Dir(p), from)
+		case "go.work":
+			return fixWorkPaths(dst, filepath.Dir(p), from)
+		}
+		return nil
+	})
+}
+
+// outsidePath returns the absolute form of the relative directory path found
+// in a go.mod or go.work file within dir, or an empty string if it is already
+// absolute, isn't a directory path or lies within root.
+func outsidePath(dirPath, dir, root string) string {
+	if !modfile.IsDirectoryPath(dirPath) || filepath.IsAbs(dirPath) {
+		return ""
+	}
+	target := filepath.Join(dir, filepath.FromSlash(dirPath))
+	if rel, err := filepath.Rel(root, target); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return target
+}
+
+// fixModPaths makes the relative replacement paths within the go.mod file at
+// modPath, copied from dir, that lie outside of root absolute.
+func fixModPaths(modPath, dir, root string) error {
+	data, err := ioutil.ReadFile(modPath)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.Parse(modPath, data, nil)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, r := range append([]*modfile.Replace(nil), f.Replace...) {
+		if r.New.Version != "" {
+			continue
+		}
+		if target := outsidePath(r.New.Path, dir, root); target != "" {
+			if err = f.AddReplace(r.Old.Path, r.Old.Version, target, ""); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	f.Cleanup()
+	if data, err = f.Format(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(modPath, data, 0644)
+}
+
+// fixWorkPaths makes the relative use and replacement paths within the
+// go.work file at workPath, copied from dir, that lie outside of root
+// absolute.
+func fixWorkPaths(workPath, dir, root string) error {
+	data, err := ioutil.ReadFile(workPath)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.ParseWork(workPath, data, nil)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, u := range append([]*modfile.Use(nil), f.Use...) {
+		if target := outsidePath(u.Path, dir, root); target != "" {
+			if err = f.DropUse(u.Path); err != nil {
+				return err
+			}
+			if err = f.AddUse(target, u.ModulePath); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	for _, r := range append([]*modfile.Replace(nil), f.Replace...) {
+		if r.New.Version != "" {
+			continue
+		}
+		if target := outsidePath(r.New.Path, dir, root); target != "" {
+			if err = f.AddReplace(r.Old.Path, r.Old.Version, target, ""); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	f.Cleanup()
+	return ioutil.WriteFile(workPath, modfile.Format(f.Syntax), 0644)
+}
+
+// fileState holds enough about a file to tell whether it has been written.
+type fileState struct {
+	size    int64
+	modTime int64
+	mode    os.FileMode
+}
+
+// snapshotTree returns the state of the regular files within the directory,
+// keyed by their path relative to it. Only the files whose state changes
+// across a directive need to have their contents examined.
+func snapshotTree(root string) (map[string]fileState, error) {
+	result := make(map[string]fileState)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		result[rel] = fileState{size: info.Size(), modTime: info.ModTime().UnixNano(), mode: info.Mode()}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+func TestFixModPaths(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	modDir := filepath.Join(root, "sub")
+	if err := os.MkdirAll(modDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	modPath := filepath.Join(dir, "go.mod")
+	data := []byte(`module example.com/repo/sub
+
+go 1.25
+
+replace (
+	example.com/inside => ../inside
+	example.com/outside => ../../outside
+	example.com/versioned => example.com/fork v1.0.0
+)
+`)
+	if err := ioutil.WriteFile(modPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fixModPaths(modPath, modDir, root); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(modPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := modfile.Parse(modPath, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"example.com/inside":    "../inside",
+		"example.com/outside":   filepath.Join(dir, "outside"),
+		"example.com/versioned": "example.com/fork",
+	}
+	for _, r := range f.Replace {
+		if r.New.Path != expected[r.Old.Path] {
+			t.Errorf("%s was replaced with %s, expected %s", r.Old.Path, r.New.Path, expected[r.Old.Path])
+		}
+		delete(expected, r.Old.Path)
+	}
+	if len(expected) != 0 {
+		t.Errorf("missing replacements: %v", expected)
+	}
+}
+
+func TestGeneratorName(t *testing.T) {
+	for _, one := range []struct {
+		directive string
+		name      string
+		ok        bool
+	}{
+		{directive: "stringer -type=Kind", name: "stringer", ok: true},
+		{directive: "./tools/stringer -type=Kind"},
+		{directive: "/tmp/x/stringer -type=Kind"},
+		{directive: `tools\stringer -type=Kind`},
+		{directive: "$GOFILE"},
+		{directive: "go run golang.org/x/tools/cmd/stringer -type=Kind", name: "golang.org/x/tools/cmd/stringer", ok: true},
+		{directive: "go run golang.org/x/tools/cmd/stringer@v0.40.0 -type=Kind", name: "golang.org/x/tools/cmd/stringer", ok: true},
+		{directive: "go run -tags foo golang.org/x/tools/cmd/stringer", name: "golang.org/x/tools/cmd/stringer", ok: true},
+		{directive: "go run -tags=foo -trimpath ./gen", name: "./gen", ok: true},
+		{directive: "go run -exec /tmp/evil/stringer golang.org/x/tools/cmd/stringer"},
+		{directive: "go run -exec=/tmp/evil/stringer golang.org/x/tools/cmd/stringer"},
+		{directive: "go run -toolexec /tmp/evil golang.org/x/tools/cmd/stringer"},
+		{directive: "go run -unknown golang.org/x/tools/cmd/stringer"},
+		{directive: "go run -tags"},
+		{directive: "go vet", name: "go", ok: true},
+	} {
+		name, ok := generatorName(strings.Fields(one.directive))
+		if name != one.name || ok != one.ok {
+			t.Errorf("%q: expected %q, %v, got %q, %v", one.directive, one.name, one.ok, name, ok)
+		}
+	}
+}
+
+func TestCheckGenerated(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod": "module example.com/fixture\n\ngo 1.16\n",
+		"main.go": `package main
+
+//go:generate go run ./gen
+//go:generate sh -c "echo package main > unallowed.go"
+//go:generate ./evil.sh
+//go:generate go run -exec ./evil.sh ./gen
+
+func main() {}
+`,
+		"gen/main.go": `package main
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	os.Remove("stale.go")
+	if err := ioutil.WriteFile("out.go", []byte("package main\n\nconst out = 2\n"), 0644); err != nil {
+		panic(err)
+	}
+}
+`,
+		"evil.sh":  "#!/bin/sh\necho package main > evil.go\n",
+		"out.go":   "package main\n\nconst out = 1\n",
+		"stale.go": "package main\n",
+	}
+	var paths []string
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(p, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".go") {
+			paths = append(paths, p)
+		}
+	}
+	l := &lint{
+		options:  options{allowedGenerators: []string{"./gen", "evil.sh", "./evil.sh"}},
+		repoPath: dir,
+		files:    paths,
+		lineChan: make(chan problem, 100),
+	}
+	l.checkGenerated(context.Background())
+	close(l.lineChan)
+	var found []string
+	for one := range l.lineChan {
+		found = append(found, one.output)
+	}
+	mainGo := filepath.Join(dir, "main.go")
+	expected := []string{
+		fmt.Sprintf("%s:3:1: Generated file %s is out of date", mainGo, filepath.Join(dir, "out.go")),
+		fmt.Sprintf("%s:3:1: File %s is removed when regenerated, but is still committed", mainGo, filepath.Join(dir, "stale.go")),
+	}
+	if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(found, "\n"))
+	}
+	if l.status == 0 {
+		t.Error("the findings didn't mark the run as failed")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/xio"
+)
+
+// goModPath returns the path to the go.mod file for the repo.
+func (l *lint) goModPath() string {
+	return filepath.Join(l.repoPath, "go.mod")
+}
+
+// goModLine returns the line within go.mod that references the module path,
+// or 1 if it cannot be found.
+func (l *lint) goModLine(modPath string) int {
+	f, err := os.Open(l.goModPath())
+	if err != nil {
+		return 1
+	}
+	defer xio.CloseIgnoringErrors(f)
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == "require" {
+			fields = fields[1:]
+		}
+		if len(fields) > 0 && fields[0] == modPath {
+			return line
+		}
+	}
+	return 1
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const licensePrefix = "license"
+
+type licenseTemplate struct {
+	id      string
+	phrases []string
+}
+
+// licenseTemplates holds distinctive passages taken from the SPDX license
+// templates. A license text is classified as the first template whose
+// phrases all appear within it, so more specific templates must come before
+// the more general ones they overlap with.
+var licenseTemplates = []licenseTemplate{
+	{id: "MPL-2.0", phrases: []string{"mozilla public license version 2 0"}},
+	{id: "AGPL-3.0", phrases: []string{"gnu affero general public license version 3 19 november 2007"}},
+	{id: "LGPL-3.0", phrases: []string{"gnu lesser general public license version 3 29 june 2007"}},
+	{id: "LGPL-2.1", phrases: []string{"gnu lesser general public license version 2 1 february 1999"}},
+	{id: "LGPL-2.0", phrases: []string{"gnu library general public license version 2 june 1991"}},
+	{id: "GPL-3.0", phrases: []string{"gnu general public license version 3 29 june 2007"}},
+	{id: "GPL-2.0", phrases: []string{"gnu general public license version 2 june 1991"}},
+	{id: "EPL-2.0", phrases: []string{"eclipse public license v 2 0"}},
+	{id: "EPL-1.0", phrases: []string{"eclipse public license v 1 0"}},
+	{id: "Apache-2.0", phrases: []string{"apache license", "version 2 0"}},
+	{id: "BSL-1.0", phrases: []string{"boost software license version 1 0"}},
+	{id: "BSD-4-Clause", phrases: []string{"redistribution and use in source and binary forms with or without modification are permitted", "all advertising materials mentioning features or use of this software must display the following acknowledgement"}},
+	{id: "BSD-3-Clause", phrases: []string{"redistribution and use in source and binary forms with or without modification are permitted", "neither the name of"}},
+	{id: "BSD-2-Clause", phrases: []string{"redistribution and use in source and binary forms with or without modification are permitted", "redistributions in binary form must reproduce the above copyright notice"}},
+	{id: "MIT", phrases: []string{"permission is hereby granted free of charge to any person obtaining a copy", "the above copyright notice and this permission notice shall be included in all copies or substantial portions of the software"}},
+	{id: "ISC", phrases: []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}},
+	{id: "Zlib", phrases: []string{"altered source versions must be plainly marked as such and must not be misrepresented as being the original software"}},
+	{id: "Unlicense", phrases: []string{"this is free and unencumbered software released into the public domain"}},
+	{id: "CC0-1.0", phrases: []string{"cc0 1 0 universal"}},
+}
+
+func (l *lint) checkModuleLicenses() {
+	modules, err := listModules()
+	if err != nil {
+		l.lineChan <- problem{prefix: licensePrefix, output: fmt.Sprintf("%s: %v", l.goModPath(), err)}
+		l.markError()
+		return
+	}
+	used, err := listBuildModules()
+	if err != nil {
+		l.lineChan <- problem{prefix: licensePrefix, output: fmt.Sprintf("%s: %v", l.goModPath(), err)}
+		l.markError()
+		return
+	}
+	hadIssue := false
+	for _, mod := range modules {
+		if mod.Main {
+			continue
+		}
+		var msg string
+		if mod.Dir == "" {
+			if !used[mod.Path] {
+				// Modules in the build list that provide no packages to the
+				// build contribute no code to it, so there is nothing to check.
+				continue
+			}
+			msg = "is not in the module cache, so its license is unknown"
+		} else if ids := classifyLicenses(mod.Dir); len(ids) == 0 {
+			msg = "has an unknown license"
+		} else if l.allLicensesDenied(ids) {
+			msg = fmt.Sprintf("uses the license %s, which is not allowed", strings.Join(ids, " or "))
+		}
+		if msg != "" {
+			hadIssue = true
+			l.lineChan <- problem{prefix: licensePrefix, output: fmt.Sprintf("%s:%d:1: %s %s %s", l.goModPath(), l.goModLine(mod.Path), mod.Path, mod.Version, msg)}
+		}
+	}
+	if hadIssue {
+		l.markError()
+	}
+}
+
+func (l *lint) allLicensesDenied(ids []string) bool {
+	for _, id := range ids {
+		if !l.licenseDenied(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *lint) licenseDenied(id string) bool {
+	for _, one := range l.deniedLicenses {
+		if strings.HasSuffix(one, "*") {
+			if strings.HasPrefix(strings.ToLower(id), strings.ToLower(one[:len(one)-1])) {
+				return true
+			}
+		} else if strings.EqualFold(id, one) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyLicenses returns the SPDX identifiers of the licenses found in the
+// license files at the root of the directory. More than one is returned when
+// a module is offered under a choice of licenses.
+func classifyLicenses(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, info := range infos {
+		if info.IsDir() || !isLicenseFile(info.Name()) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			continue
+		}
+		if id := classifyLicense(string(data)); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func isLicenseFile(name string) bool {
+	lower := strings.ToLower(name)
+	for _, prefix := range []string{"license", "licence", "copying", "unlicense"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyLicense(text string) string {
+	text = normalizeLicenseText(text)
+	for _, one := range licenseTemplates {
+		matched := true
+		for _, phrase := range one.phrases {
+			if !strings.Contains(text, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return one.id
+		}
+	}
+	return ""
+}
+
+// normalizeLicenseText lowercases the text and reduces any run of characters
+// other than letters and digits to a single space, so that differences in
+// punctuation and line wrapping don't affect matching.
+func normalizeLicenseText(text string) string {
+	var buffer strings.Builder
+	buffer.WriteByte(' ')
+	space := true
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			buffer.WriteRune(r)
+			space = false
+		} else if !space {
+			buffer.WriteByte(' ')
+			space = true
+		}
+	}
+	return buffer.String()
+}
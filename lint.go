@@ -20,19 +20,51 @@ import (
 )
 
 type lint struct {
-	origPath            string
-	repoPath            string
-	pkgs                []string
-	dirs                []string
-	files               []string
-	linters             []linter
+	options
+	origPath string
+	repoPath string
+	pkgs     []string
+	dirs     []string
+	files    []string
+	// handwritten holds the files within files that weren't generated.
+	handwritten []string
+	generated   map[string]bool
+	linters     []linter
+	workers     int
+	status      int32
+	failureLock sync.Mutex
+	failures    []string
+	statsLock   sync.Mutex
+	linterStats []*linterStats
+	findings    map[string]int
+	lineChan    chan problem
+	doneChan    chan bool
+}
+
+type options struct {
 	disallowedImports   []string
 	disallowedFunctions []string
-	status              int32
-	lineChan            chan problem
-	doneChan            chan bool
+	checkLicenses       bool
+	deniedLicenses      []string
+	vulnDBPath          string
+	vulnCalledOnly      bool
+	fix                 bool
+	allowedGenerators   []string
+	lintGenerated       []string
+	inProcess           bool
+	vetFlags            []string
 	parallel            bool
+	jobs                int
+	cpuBudget           int
+	shards              int
 	dryRun              bool
+	// linterTimeouts holds the timeouts given with --linter-timeout, which
+	// override those in the linter definitions.
+	linterTimeouts map[string]time.Duration
+	stats          bool
+	statsJSON      string
+	// prio is the priority the linters are started with.
+	prio priority
 }
 
 type problem struct {
@@ -40,15 +72,13 @@ type problem struct {
 	output string
 }
 
-func newLint(lintersToRun []linter, disallowedImports, disallowedFunctions []string, parallel, dryRun bool) (*lint, error) {
+func newLint(lintersToRun []linter, opts options) (*lint, error) {
 	l := &lint{
-		linters:             lintersToRun,
-		disallowedImports:   disallowedImports,
-		disallowedFunctions: disallowedFunctions,
-		lineChan:            make(chan problem, 16),
-		doneChan:            make(chan bool),
-		parallel:            parallel,
-		dryRun:              dryRun,
+		options:  opts,
+		linters:  lintersToRun,
+		findings: make(map[string]int),
+		lineChan: make(chan problem, 16),
+		doneChan: make(chan bool),
 	}
 	var err error
 	if l.origPath, err = filepath.Abs("."); err != nil {
@@ -65,30 +95,71 @@ func newLint(lintersToRun []linter, disallowedImports, disallowedFunctions []str
 }
 
 func (l *lint) run(timeout time.Duration) int {
+	start := time.Now()
 	go l.parseLines()
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	if len(l.disallowedImports) > 0 || len(l.disallowedFunctions) > 0 {
-		l.checkDisallowed()
+	disallow := len(l.disallowedImports) > 0 || len(l.disallowedFunctions) > 0
+	if disallow && !l.inProcess {
+		span := runTrace.begin(disallowPrefix, "check", 0)
+		l.timeBuiltIn(disallowPrefix, nil, l.checkDisallowed)
+		span.end()
+	}
+	if l.checkLicenses {
+		span := runTrace.begin("licenses", "check", 0)
+		l.timeBuiltIn(licensePrefix, nil, l.checkModuleLicenses)
+		span.end()
 	}
+	if l.vulnDBPath != "" {
+		span := runTrace.begin("vulnerabilities", "check", 0)
+		l.timeBuiltIn(vulnPrefix, nil, l.checkVulnerabilities)
+		span.end()
+	}
+	inProcess, external := l.inProcessLinters()
+	l.workers = 1
 	if l.parallel {
-		queue := taskqueue.New(taskqueue.Workers(runtime.NumCPU()), taskqueue.Log(l.logger))
-		for _, one := range l.linters {
-			queue.Submit(l.workFunc(ctx, one))
+		l.workers = runtime.NumCPU()
+		if l.jobs > 0 {
+			l.workers = l.jobs
+		}
+		if l.cpuBudget > 0 && l.workers > l.cpuBudget {
+			l.workers = l.cpuBudget
+		}
+		queue := taskqueue.New(taskqueue.Workers(l.workers), taskqueue.Log(l.logger))
+		if l.inProcess {
+			queue.Submit(func() {
+				l.traceAnalyzers(ctx, inProcess, disallow)
+			})
+		}
+		for _, one := range external {
+			dl := &linterDeadline{timeout: l.linterTimeout(one)}
+			for _, sh := range l.linterShards(one) {
+				queue.Submit(l.workFunc(ctx, one, sh, dl))
+			}
 		}
 		queue.Shutdown()
 	} else {
-		for _, one := range l.linters {
-			l.execLinter(ctx, one)
-			if ctx.Err() == context.DeadlineExceeded {
-				break
+		if l.inProcess {
+			l.traceAnalyzers(ctx, inProcess, disallow)
+		}
+		for _, one := range external {
+			dl := &linterDeadline{timeout: l.linterTimeout(one)}
+			for _, sh := range l.linterShards(one) {
+				l.execLinter(ctx, one, sh, dl)
 			}
 		}
 	}
 	close(l.lineChan)
 	<-l.doneChan
-	if l.status != 0 && ctx.Err() == context.DeadlineExceeded {
+	if ctx.Err() == context.DeadlineExceeded {
 		fmt.Fprintln(os.Stderr, "*** Timeout exceeded ***")
+		runTrace.instant("overall timeout", "timeout", 0, map[string]interface{}{"timeout": timeout.String()})
+	}
+	for _, one := range l.failures {
+		fmt.Fprintf(os.Stderr, "*** %s ***\n", one)
+	}
+	if err := l.reportStats(time.Since(start), l.workers); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to report statistics:", err)
 	}
 	return int(l.status)
 }
@@ -97,9 +168,27 @@ func (l *lint) logger(v ...interface{}) {
 	fmt.Fprintln(os.Stderr, v...)
 }
 
-func (l *lint) workFunc(ctx context.Context, lntr linter) func() {
+// traceAnalyzers runs the in-process analyzers within a span of the trace.
+func (l *lint) traceAnalyzers(ctx context.Context, linters []linter, includeDisallow bool) {
+	lane := runTrace.acquireLane()
+	defer runTrace.releaseLane(lane)
+	span := runTrace.begin(analysisPrefix+" (in-process)", "linter", lane)
+	defer span.end()
+	covers := make([]string, 0, len(linters)+1)
+	for _, one := range linters {
+		covers = append(covers, one.Name())
+	}
+	if includeDisallow {
+		covers = append(covers, disallowPrefix)
+	}
+	l.timeBuiltIn(analysisPrefix, covers, func() {
+		l.runAnalyzers(ctx, linters, includeDisallow)
+	})
+}
+
+func (l *lint) workFunc(ctx context.Context, lntr linter, sh shard, dl *linterDeadline) func() {
 	return func() {
-		l.execLinter(ctx, lntr)
+		l.execLinter(ctx, lntr, sh, dl)
 	}
 }
 
@@ -113,28 +202,44 @@ func (l *lint) collectPackagesAndFiles() error {
 	if err != nil {
 		return err
 	}
-	l.files, err = listFiles()
-	if err != nil {
+	if l.files, err = listFiles(); err != nil {
 		return err
 	}
+	l.generated = make(map[string]bool)
+	for _, one := range l.files {
+		if isGenerated(one) {
+			l.generated[one] = true
+		} else {
+			l.handwritten = append(l.handwritten, one)
+		}
+	}
 	if len(l.files) == 0 {
 		return fmt.Errorf("No files to process")
 	}
 	return nil
 }
 
-func (l *lint) argSubstitution(lntr linter) []string {
-	result := make([]string, 0, len(lntr.args))
-	for _, arg := range lntr.args {
+func (l *lint) argSubstitution(lntr linter, sh shard) []string {
+	args := lntr.Args()
+	result := make([]string, 0, len(args))
+	// Only the first list is split across shards, matching shardedArgs
+	portion := sh.portion
+	whole := func(list []string) []string { return list }
+	for _, arg := range args {
 		switch arg {
 		case REPO:
 			result = append(result, l.repoPath)
 		case FILES:
-			result = append(result, l.files...)
+			result = append(result, portion(l.linterFiles(lntr))...)
+			portion = whole
 		case DIRS:
-			result = append(result, l.dirs...)
+			result = append(result, portion(l.dirs)...)
+			portion = whole
 		case PKGS:
-			result = append(result, l.pkgs...)
+			result = append(result, portion(l.pkgs)...)
+			portion = whole
+		case VETFLAGS:
+			result = append(result, l.vetFlags...)
 		default:
 			result = append(result, arg)
 		}
@@ -142,6 +247,15 @@ func (l *lint) argSubstitution(lntr linter) []string {
 	return result
 }
 
+// linterFiles returns the files substituted for @files for the linter, which
+// exclude generated files unless --lint-generated was given for it.
+func (l *lint) linterFiles(lntr linter) []string {
+	if l.lintsGenerated(lntr.Name()) {
+		return l.files
+	}
+	return l.handwritten
+}
+
 func (l *lint) parseLines() {
 	for line := range l.lineChan {
 		l.processLine(line)
@@ -149,27 +263,114 @@ func (l *lint) parseLines() {
 	l.doneChan <- true
 }
 
-func (l *lint) execLinter(ctx context.Context, lntr linter) {
-	if l.dryRun {
+// linterTimeout returns the time the linter is allowed to run for, or zero if
+// it is only limited by the overall timeout.
+func (l *lint) linterTimeout(lntr linter) time.Duration {
+	if timeout, ok := l.linterTimeouts[lntr.Name()]; ok {
+		return timeout
+	}
+	return lntr.timeout
+}
+
+// linterDeadline is shared by the shards of a linter, so that its timeout
+// applies to the linter as a whole rather than to each shard. The deadline is
+// set when the first shard starts.
+type linterDeadline struct {
+	timeout  time.Duration
+	once     sync.Once
+	deadline time.Time
+}
+
+// context returns a context that is done when the deadline passes.
+func (dl *linterDeadline) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	dl.once.Do(func() {
+		dl.deadline = time.Now().Add(dl.timeout)
+	})
+	return context.WithDeadline(ctx, dl.deadline)
+}
+
+func (l *lint) execLinter(ctx context.Context, lntr linter, sh shard, dl *linterDeadline) {
+	label := sh.label(lntr.Name())
+	lane := runTrace.acquireLane()
+	defer runTrace.releaseLane(lane)
+	span := runTrace.begin(label, "linter", lane)
+	defer span.end()
+	if !l.dryRun {
+		if ctx.Err() != nil {
+			l.toolFailed(label, "skipped, since the overall timeout was exceeded")
+			span.arg("skipped", true)
+			return
+		}
+		overall := ctx
+		timeout := dl.timeout
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = dl.context(ctx)
+			defer cancel()
+			if ctx.Err() != nil {
+				l.toolFailed(label, "skipped, since its other shards exceeded its timeout of "+timeout.String())
+				span.arg("skipped", true)
+				return
+			}
+		}
+		start := time.Now()
+		defer func() {
+			if ctx.Err() == context.DeadlineExceeded {
+				reason := "the overall timeout"
+				if overall.Err() == nil {
+					reason = "its timeout of " + timeout.String()
+				}
+				l.toolFailed(label, fmt.Sprintf("killed after %v, having exceeded %s", time.Since(start).Round(time.Millisecond), reason))
+				runTrace.instant("timeout", "timeout", lane, map[string]interface{}{"linter": label, "reason": reason})
+			}
+		}()
+	}
+	stats := l.startStats(lntr.Name())
+	if stats != nil {
+		start := time.Now()
+		defer func() {
+			stats.WallSeconds = time.Since(start).Seconds()
+			l.finishStats(stats)
+		}()
+	}
+	if lntr.check != nil {
+		if l.dryRun {
+			l.lineChan <- problem{output: lntr.Name() + " (built-in)"}
+		} else {
+			if stats != nil {
+				stats.BuiltIn = true
+			}
+			lntr.check(l, ctx)
+		}
+	} else if l.dryRun {
 		var buffer strings.Builder
 		buffer.WriteString(lntr.cmd)
-		for _, one := range l.argSubstitution(lntr) {
+		for _, one := range l.argSubstitution(lntr, sh) {
 			buffer.WriteString(" ")
 			buffer.WriteString(one)
 		}
 		l.lineChan <- problem{output: buffer.String()}
 	} else {
 		prefix := lntr.Name()
-		cc := exec.CommandContext(ctx, lntr.cmd, l.argSubstitution(lntr)...)
+		cmdPath, err := lntr.Path()
+		if err != nil {
+			cmdPath = lntr.cmd
+		}
+		cc := exec.CommandContext(ctx, cmdPath, l.argSubstitution(lntr, sh)...)
+		if l.cpuBudget > 0 {
+			cc.Env = append(os.Environ(), fmt.Sprintf("GOMAXPROCS=%d", l.linterMaxProcs()))
+		}
 
 		stdout, err := cc.StdoutPipe()
 		if err != nil {
 			l.lineChan <- problem{prefix: prefix, output: err.Error()}
+			stats.recordProcess(nil, 0)
 			return
 		}
 		stderr, err := cc.StderrPipe()
 		if err != nil {
 			l.lineChan <- problem{prefix: prefix, output: err.Error()}
+			stats.recordProcess(nil, 0)
 			return
 		}
 
@@ -183,15 +384,32 @@ func (l *lint) execLinter(ctx context.Context, lntr linter) {
 		defer func() {
 			removeRunningCmdChan <- cc
 		}()
-		if err = cc.Start(); err != nil {
+		if err = l.prio.start(cc); err != nil {
 			xio.CloseIgnoringErrors(stdout)
 			xio.CloseIgnoringErrors(stderr)
-			l.lineChan <- problem{prefix: prefix, output: err.Error()}
+			l.toolFailed(label, "could not be started: "+err.Error())
+			stats.recordProcess(nil, 0)
 			return
 		}
+		stopMemory := func() int64 { return 0 }
+		if stats != nil {
+			stopMemory = watchMemory(cc.Process.Pid)
+		}
 		cc.Wait() // @allow
+		peak := stopMemory()
 		wg.Wait()
+		stats.recordProcess(cc.ProcessState, peak)
+		span.arg("exit_status", cc.ProcessState.ExitCode())
+	}
+}
+
+// linterMaxProcs returns the GOMAXPROCS value each linter is given, sharing
+// the CPU budget between the workers.
+func (l *lint) linterMaxProcs() int {
+	if n := l.cpuBudget / l.workers; n > 1 {
+		return n
 	}
+	return 1
 }
 
 func (l *lint) scanOutput(prefix string, r io.Reader, wg *sync.WaitGroup) {
@@ -213,16 +431,14 @@ func (l *lint) processLine(line problem) {
 		if strings.HasPrefix(output, "vendor") {
 			return
 		}
-		if strings.Contains(output, "@allow") {
-			return
-		}
-		if strings.Contains(output, "(SA3000)") {
+		if strings.HasPrefix(output, "# ") {
+			// Package headers emitted by go vet
 			return
 		}
-		if strings.Contains(output, ".pb.go") {
+		if strings.Contains(output, "@allow") {
 			return
 		}
-		if strings.Contains(output, "mock_grpc") {
+		if strings.Contains(output, "(SA3000)") {
 			return
 		}
 		if strings.Contains(output, "couldn't load packages due to errors:") {
@@ -231,6 +447,9 @@ func (l *lint) processLine(line problem) {
 		if strings.HasPrefix(output, line.prefix+": ") {
 			output = output[len(line.prefix)+2:]
 		}
+		if l.inGeneratedFile(output) && !l.lintsGenerated(line.prefix) && !reportsGenerated[line.prefix] {
+			return
+		}
 		if filepath.IsAbs(output) {
 			if replacement, err := filepath.Rel(l.origPath, output); err == nil {
 				output = replacement
@@ -240,10 +459,61 @@ func (l *lint) processLine(line problem) {
 			output += ":1:1:"
 		}
 		fmt.Fprintf(os.Stderr, "%s [%s]\n", output, line.prefix)
+		l.findings[line.prefix]++
 		l.markError()
 	}
 }
 
+// reportsGenerated holds the built-in checks whose findings within generated
+// files are always reported, since they concern the generated code itself.
+var reportsGenerated = map[string]bool{
+	disallowPrefix: true,
+	vulnPrefix:     true,
+	generatePrefix: true,
+}
+
+// lintsGenerated returns true if the named linter should also be run
+// against generated files.
+func (l *lint) lintsGenerated(name string) bool {
+	for _, one := range l.lintGenerated {
+		if one == name {
+			return true
+		}
+	}
+	return false
+}
+
+// inGeneratedFile returns true if the output refers to a location within a
+// generated file.
+func (l *lint) inGeneratedFile(output string) bool {
+	if len(l.generated) == 0 {
+		return false
+	}
+	start := 0
+	if filepath.VolumeName(output) != "" {
+		start = len(filepath.VolumeName(output))
+	}
+	i := strings.IndexByte(output[start:], ':')
+	if i == -1 {
+		return false
+	}
+	path := output[:start+i]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.repoPath, path)
+	}
+	return l.generated[filepath.Clean(path)]
+}
+
 func (l *lint) markError() {
-	atomic.StoreInt32(&l.status, 1)
+	atomic.CompareAndSwapInt32(&l.status, 0, 1)
+}
+
+// toolFailed records that the named linter failed to complete, which is
+// reported separately from the problems found and results in an exit status
+// of 2.
+func (l *lint) toolFailed(name, msg string) {
+	l.failureLock.Lock()
+	l.failures = append(l.failures, name+" "+msg)
+	l.failureLock.Unlock()
+	atomic.StoreInt32(&l.status, 2)
 }
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/richardwilkes/toolbox/atexit"
+	"golang.org/x/tools/go/analysis"
 )
 
 // Argument substitution constants
@@ -14,65 +19,347 @@ const (
 	PKGS  = "@pkgs"
 	DIRS  = "@dirs"
 	FILES = "@files"
+	// VETFLAGS is replaced by the flags given with --vet-flag.
+	VETFLAGS = "@vetflags"
 )
 
-var (
-	// FastLinters holds the linters that are known to execute quickly.
-	FastLinters = []linter{
-		{cmd: "gofmt", args: []string{"-l", "-s", FILES}},
-		{cmd: "goimports", args: []string{"-l", FILES}, pkg: "golang.org/x/tools/cmd/goimports"},
-		{cmd: "golint", args: []string{PKGS}, pkg: "golang.org/x/lint/golint"},
-		{cmd: "ineffassign", args: []string{REPO}, pkg: "github.com/gordonklaus/ineffassign"},
-		{cmd: "misspell", args: []string{"-locale", "US", FILES}, pkg: "github.com/client9/misspell/cmd/misspell"},
-		{cmd: "go", args: []string{"tool", "vet", "-all", "-shadow", DIRS}},
-	}
-	// SlowLinters holds the linters that are known to execute slowly.
-	SlowLinters = []linter{
-		{cmd: "staticcheck", args: []string{"-checks", "all,-ST1000,-ST1005", PKGS}, pkg: "honnef.co/go/tools/cmd/staticcheck"},
-		{cmd: "errcheck", args: []string{"-abspath", "-blank", "-asserts", "-ignore", "github.com/richardwilkes/errs:Append", "-ignore", "github.com/richardwilkes/toolbox/errs:Append", "-ignore", "io:CloseWithError", PKGS}, pkg: "github.com/kisielk/errcheck"},
-		{cmd: "unconvert", args: []string{PKGS}, pkg: "github.com/mdempsky/unconvert"},
-	}
+// Built-in linter groups. Every linter is a member of either the fast or slow
+// group, in addition to the group given in its definition.
+const (
+	FastGroup = "fast"
+	SlowGroup = "slow"
 )
 
+// Linters holds all of the known linters, in the order they are run.
+var Linters = []linter{
+	{cmd: "gofmt", args: []string{"-l", "-s", FILES}, shardable: true, group: "format"},
+	{cmd: "goimports", args: []string{"-l", FILES}, pkg: "golang.org/x/tools/cmd/goimports", version: "v0.40.0", minGo: "1.24", shardable: true, group: "format"},
+	{cmd: "golint", args: []string{PKGS}, pkg: "golang.org/x/lint/golint", version: "v0.0.0-20210508222113-6edffad5e616", shardable: true, group: "style"},
+	{cmd: "ineffassign", args: []string{REPO}, pkg: "github.com/gordonklaus/ineffassign", version: "v0.2.0", minGo: "1.23", group: "correctness", analyzers: ineffassignAnalyzers},
+	{cmd: "misspell", args: []string{"-locale", "US", FILES}, pkg: "github.com/client9/misspell/cmd/misspell", version: "v0.3.4", shardable: true, group: "style"},
+	{cmd: "go", args: []string{"vet", VETFLAGS, PKGS}, legacyBefore: "1.10", legacyArgs: []string{"tool", "vet", "-all", "-shadow", DIRS}, shardable: true, group: "correctness", analyzers: vetAnalyzers},
+	{cmd: "shadow", args: []string{PKGS}, pkg: "golang.org/x/tools/go/analysis/passes/shadow/cmd/shadow", version: "v0.40.0", minGo: "1.24", shardable: true, group: "correctness", analyzers: shadowAnalyzers},
+	{cmd: "tidy", check: (*lint).checkTidy, group: "modules"},
+	{cmd: "staticcheck", args: []string{"-checks", "all,-ST1000,-ST1005", PKGS}, pkg: "honnef.co/go/tools/cmd/staticcheck", version: "v0.7.0", minGo: "1.25", shardable: true, group: "correctness", slow: true, timeout: 4 * time.Minute, analyzers: staticcheckAnalyzers},
+	{cmd: "errcheck", args: []string{"-abspath", "-blank", "-asserts", "-ignore", "github.com/richardwilkes/errs:Append", "-ignore", "github.com/richardwilkes/toolbox/errs:Append", "-ignore", "io:CloseWithError", PKGS}, pkg: "github.com/kisielk/errcheck", version: "v1.10.0", minGo: "1.22", shardable: true, group: "correctness", slow: true, timeout: 2 * time.Minute, analyzers: errcheckAnalyzers},
+	{cmd: "unconvert", args: []string{PKGS}, pkg: "github.com/mdempsky/unconvert", version: "v0.0.0-20260816212528-33842c47157a", minGo: "1.25", group: "style", slow: true, timeout: 2 * time.Minute},
+	{cmd: "generate", check: (*lint).checkGenerated, group: "correctness", slow: true, timeout: 3 * time.Minute},
+}
+
 type linter struct {
 	cmd  string
 	args []string
 	pkg  string
+	// version, if set, pins the version of the module providing pkg.
+	version string
+	// check, if set, is called to perform the linting in-process rather than
+	// running cmd.
+	check func(l *lint, ctx context.Context)
+	// analyzers, if set, returns the go/analysis analyzers equivalent to
+	// running cmd, for use when running in-process.
+	analyzers func() []*analysis.Analyzer
+	// legacyArgs, if set, are used in place of args when the go toolchain is
+	// older than legacyBefore.
+	legacyArgs   []string
+	legacyBefore string
+	// minGo, if set, is the oldest go toolchain the linter works with.
+	minGo string
+	// timeout, if set, limits how long the linter may run for, in addition to
+	// the overall timeout. It applies to all of the linter's shards together.
+	// It isn't enforced when the linter is run in-process, as the analysis
+	// pass can't be interrupted, so only the overall timeout applies then.
+	timeout time.Duration
+	// shardable is set for linters that check each package or file
+	// independently, so their @pkgs, @files or @dirs arguments may be split
+	// across several processes with --shards.
+	shardable bool
+	group     string
+	slow      bool
 }
 
 func (lntr *linter) Name() string {
-	if lntr.cmd == "go" && len(lntr.args) > 1 {
-		return lntr.args[1]
+	if lntr.cmd == "go" && len(lntr.args) > 0 {
+		if lntr.args[0] == "tool" && len(lntr.args) > 1 {
+			return lntr.args[1]
+		}
+		return lntr.args[0]
 	}
 	return lntr.cmd
 }
 
-func (lntr *linter) Install(force bool) {
-	if lntr.pkg != "" {
-		if !force {
-			if _, err := exec.LookPath(lntr.cmd); err == nil {
+// Args returns the unsubstituted arguments appropriate for the go toolchain.
+func (lntr *linter) Args() []string {
+	if lntr.legacyArgs != nil && toolchainBefore(lntr.legacyBefore) {
+		return lntr.legacyArgs
+	}
+	return lntr.args
+}
+
+// Groups returns the built-in groups the linter is a member of.
+func (lntr *linter) Groups() []string {
+	speed := FastGroup
+	if lntr.slow {
+		speed = SlowGroup
+	}
+	return []string{lntr.group, speed}
+}
+
+// Path returns the absolute location of the linter's binary. A pinned linter
+// is only looked for in its dirt-managed tool directory, so that projects
+// pinning different versions don't interfere with each other. Otherwise, the
+// PATH is searched, followed by the directory go install places binaries
+// into.
+func (lntr *linter) Path() (string, error) {
+	if lntr.version != "" {
+		dir, err := lntr.toolDir()
+		if err != nil {
+			return "", err
+		}
+		return exec.LookPath(filepath.Join(dir, lntr.cmd))
+	}
+	path, err := exec.LookPath(lntr.cmd)
+	if err == nil {
+		return path, nil
+	}
+	if dir, derr := activeToolchain().binDir(); derr == nil {
+		if p, lerr := exec.LookPath(filepath.Join(dir, lntr.cmd)); lerr == nil {
+			return p, nil
+		}
+	}
+	return "", err
+}
+
+// CheckToolchain returns an error if the linter is known to be incompatible
+// with the active go toolchain.
+func (lntr *linter) CheckToolchain() error {
+	if toolchainBefore(lntr.minGo) {
+		return fmt.Errorf("%s requires go%s or later, but the active toolchain is %s. Use --skip %s to run without it", lntr.Name(), lntr.minGo, goVersion(), lntr.Name())
+	}
+	return nil
+}
+
+// Install installs the linter if it can't be found or force is set. When the
+// linter has a version pin and the toolchain supports it, the pinned version
+// is installed into the linter's dirt-managed tool directory. An installed
+// binary whose embedded build information doesn't match the pin is either
+// reported or, if reinstallMismatched is set, replaced.
+func (lntr *linter) Install(force, reinstallMismatched bool) {
+	if lntr.pkg == "" {
+		return
+	}
+	if !force {
+		path, err := lntr.Path()
+		if err == nil {
+			if lntr.version == "" {
 				// command already exists, so bail
 				return
 			}
+			installed := binaryModuleVersion(path)
+			if installed == lntr.version {
+				runTrace.instant("tool cache hit", "cache", 0, map[string]interface{}{"linter": lntr.Name(), "version": lntr.version, "path": path})
+				return
+			}
+			if !reinstallMismatched {
+				fmt.Fprintf(os.Stderr, "Warning: %s at %s is version %s, but version %s is pinned. Use --reinstall-mismatched to replace it\n", lntr.Name(), path, installed, lntr.version)
+				return
+			}
 		}
-		cmd := exec.Command("go", "get", "-u", lntr.pkg)
-		if data, err := cmd.CombinedOutput(); err != nil {
+	}
+	var cmd *exec.Cmd
+	if activeToolchain().supportsModuleInstall() {
+		var err error
+		if cmd, err = lntr.moduleInstallCmd(goEnv()); err != nil {
 			fmt.Fprintln(os.Stderr, "Unable to install", lntr.Name())
-			fmt.Fprintln(os.Stderr, string(data))
+			fmt.Fprintln(os.Stderr, err)
 			atexit.Exit(1)
 		}
+	} else {
+		if lntr.version != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s cannot install pinned versions, so the latest version of %s will be installed instead\n", goVersion(), lntr.Name())
+		}
+		cmd = exec.Command("go", "get", "-u", lntr.pkg)
+	}
+	span := runTrace.begin("install "+lntr.Name(), "install", 0)
+	data, err := cmd.CombinedOutput()
+	span.end()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to install", lntr.Name())
+		fmt.Fprintln(os.Stderr, string(data))
+		atexit.Exit(1)
+	}
+	if lntr.version != "" {
+		fmt.Println("Installed", lntr.Name(), lntr.version)
+	} else {
 		fmt.Println("Installed", lntr.Name())
 	}
 }
 
-func selectLinters(fastOnly bool) []linter {
+// moduleInstallCmd returns the command that installs the linter with
+// "go install pkg@version", using the specified environment. A pinned linter
+// is installed into its dirt-managed tool directory.
+func (lntr *linter) moduleInstallCmd(env []string) (*exec.Cmd, error) {
+	target := "latest"
+	if lntr.version != "" {
+		target = lntr.version
+	}
+	cmd := exec.Command("go", "install", lntr.pkg+"@"+target)
+	cmd.Env = env
+	if lntr.version != "" {
+		dir, err := lntr.toolDir()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, "GOBIN="+dir)
+	}
+	return cmd, nil
+}
+
+// findLinter returns the linter with the specified name, or nil if there is
+// no such linter.
+func findLinter(name string) *linter {
+	for i := range Linters {
+		if Linters[i].Name() == name {
+			return &Linters[i]
+		}
+	}
+	return nil
+}
+
+// groupNames returns the names of the built-in groups, in the order they
+// first appear within Linters, followed by the fast and slow groups.
+func groupNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, one := range Linters {
+		if !seen[one.group] {
+			seen[one.group] = true
+			names = append(names, one.group)
+		}
+	}
+	return append(names, FastGroup, SlowGroup)
+}
+
+// builtinGroups returns the members of each built-in group.
+func builtinGroups() map[string][]string {
+	groups := make(map[string][]string)
+	for _, one := range Linters {
+		for _, group := range one.Groups() {
+			groups[group] = append(groups[group], one.Name())
+		}
+	}
+	return groups
+}
+
+// linterGroups returns the members of each group, including any user-defined
+// groups. User-defined groups are specified as "name=linter,linter,...".
+func linterGroups(defined []string) (map[string][]string, error) {
+	groups := builtinGroups()
+	known := make(map[string]bool)
+	for _, one := range Linters {
+		known[one.Name()] = true
+	}
+	for _, one := range defined {
+		parts := strings.SplitN(one, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("Invalid group definition: %s", one)
+		}
+		name := strings.TrimSpace(parts[0])
+		members := splitList([]string{parts[1]})
+		for _, member := range members {
+			if !known[member] {
+				return nil, fmt.Errorf("Unknown linter %s in group %s", member, name)
+			}
+		}
+		groups[name] = members
+	}
+	return groups, nil
+}
+
+// selectLinters returns the linters to run. If any names are specified with
+// only, just those linters are selected. Otherwise, if any groups are
+// specified, the members of those groups are selected, and if not, all
+// linters are selected. Any linters specified with skip, as well as the slow
+// linters when fastOnly is set, are then removed.
+func selectLinters(groupNames, defined, only, skip []string, fastOnly bool) ([]linter, error) {
+	groups, err := linterGroups(defined)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, one := range Linters {
+		known[one.Name()] = true
+	}
+	var selected map[string]bool
+	only = splitList(only)
+	groupNames = splitList(groupNames)
+	switch {
+	case len(only) > 0:
+		selected = make(map[string]bool)
+		for _, one := range only {
+			if !known[one] {
+				return nil, fmt.Errorf("Unknown linter: %s", one)
+			}
+			selected[one] = true
+		}
+	case len(groupNames) > 0:
+		selected = make(map[string]bool)
+		for _, one := range groupNames {
+			members, ok := groups[one]
+			if !ok {
+				return nil, fmt.Errorf("Unknown linter group: %s", one)
+			}
+			for _, member := range members {
+				selected[member] = true
+			}
+		}
+	}
+	skipped := make(map[string]bool)
+	for _, one := range splitList(skip) {
+		if !known[one] {
+			return nil, fmt.Errorf("Unknown linter: %s", one)
+		}
+		skipped[one] = true
+	}
 	var list []linter
-	if fastOnly {
-		list = FastLinters
-	} else {
-		list = make([]linter, len(FastLinters)+len(SlowLinters))
-		copy(list, FastLinters)
-		copy(list[len(FastLinters):], SlowLinters)
+	for _, one := range Linters {
+		name := one.Name()
+		if (selected == nil || selected[name]) && !skipped[name] && !(fastOnly && one.slow) {
+			list = append(list, one)
+		}
+	}
+	return list, nil
+}
+
+// parseLinterTimeouts returns the timeouts specified as "linter=duration".
+func parseLinterTimeouts(specs []string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, one := range specs {
+		parts := strings.SplitN(one, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid linter timeout: %s", one)
+		}
+		name := strings.TrimSpace(parts[0])
+		if findLinter(name) == nil {
+			return nil, fmt.Errorf("Unknown linter: %s", name)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("Invalid linter timeout: %s", one)
+		}
+		timeouts[name] = timeout
+	}
+	return timeouts, nil
+}
+
+// splitList splits each entry on commas, returning the non-empty results.
+func splitList(in []string) []string {
+	var result []string
+	for _, one := range in {
+		for _, part := range strings.Split(one, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
 	}
-	return list
+	return result
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+)
+
+type lintersCmd struct {
+	definedGroups *[]string
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *lintersCmd) Name() string {
+	return "linters"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *lintersCmd) Usage() string {
+	return "List the known linters along with their groups, whether they are installed, their version and their pinned version."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *lintersCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	cl.Parse(args)
+	groups, err := linterGroups(*c.definedGroups)
+	if err != nil {
+		return err
+	}
+	memberOf := make(map[string][]string)
+	for group, members := range groups {
+		for _, one := range members {
+			memberOf[one] = append(memberOf[one], group)
+		}
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tGROUPS\tINSTALLED\tVERSION\tPINNED")
+	for i := range Linters {
+		one := &Linters[i]
+		name := one.Name()
+		sort.Strings(memberOf[name])
+		installed, version := one.installedVersion()
+		pinned := one.version
+		if pinned == "" {
+			pinned = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, strings.Join(memberOf[name], ","), installed, version, pinned)
+	}
+	return tw.Flush()
+}
+
+// installedVersion returns the location of the linter's binary, or "no" if
+// it cannot be found, along with its version.
+func (lntr *linter) installedVersion() (installed, version string) {
+	if lntr.check != nil {
+		return "built-in", cmdline.AppVersion
+	}
+	path, err := lntr.Path()
+	if err != nil {
+		return "no", ""
+	}
+	return path, lntr.binaryVersion(path)
+}
+
+// binaryVersion returns the version of the linter's binary at path.
+func (lntr *linter) binaryVersion(path string) string {
+	if lntr.pkg == "" {
+		// Part of the Go distribution
+		return goVersion()
+	}
+	return binaryModuleVersion(path)
+}
+
+// binaryModuleVersion returns the version of the main module that was used
+// to build the binary, as recorded in its embedded build information.
+func binaryModuleVersion(path string) string {
+	return readBuildInfo(path).version
+}
+
+// buildInfo holds the parts of a binary's embedded build information that
+// dirt cares about.
+type buildInfo struct {
+	goVersion string
+	module    string
+	version   string
+}
+
+// readBuildInfo returns the embedded build information of the binary, as
+// reported by "go version -m". Any values that cannot be determined are set to
+// "unknown".
+func readBuildInfo(path string) buildInfo {
+	info := buildInfo{goVersion: "unknown", module: "unknown", version: "unknown"}
+	out, err := exec.Command("go", "version", "-m", path).Output()
+	if err != nil {
+		return info
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, path+": ") && len(fields) > 1:
+			info.goVersion = fields[len(fields)-1]
+		case len(fields) >= 3 && fields[0] == "mod":
+			info.module = fields[1]
+			info.version = fields[2]
+		}
+	}
+	return info
+}
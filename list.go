@@ -3,17 +3,24 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/richardwilkes/toolbox/errs"
+	"github.com/richardwilkes/toolbox/xio"
 	"github.com/richardwilkes/toolbox/xio/fs"
 )
 
-var vendor = fmt.Sprintf("%[1]cvendor%[1]c", os.PathSeparator)
+var (
+	vendor          = fmt.Sprintf("%[1]cvendor%[1]c", os.PathSeparator)
+	generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+)
 
 func listPackages() ([]string, error) {
 	return golist()
@@ -32,6 +39,9 @@ func golist(extra ...string) ([]string, error) {
 	args = append(args, "list")
 	args = append(args, extra...)
 	args = append(args, "./...")
+	span := runTrace.begin("go list", "go list", 0)
+	span.arg("args", strings.Join(args, " "))
+	defer span.end()
 	cmd := exec.Command("go", args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -50,6 +60,102 @@ func golist(extra ...string) ([]string, error) {
 	return result, nil
 }
 
+// isGenerated returns true if the Go file has the standard comment marking it
+// as generated before its package clause.
+func isGenerated(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer xio.CloseIgnoringErrors(f)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if generatedMarker.MatchString(line) {
+			return true
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+	}
+	return false
+}
+
+type module struct {
+	Path    string
+	Version string
+	Dir     string
+	Main    bool
+	Replace *module
+}
+
+// listModules returns the modules in the build list of the main module. Only
+// the local module cache is consulted, so modules whose source has never been
+// downloaded will have an empty Dir.
+func listModules() ([]*module, error) {
+	args := []string{"list", "-m", "-json", "all"}
+	span := runTrace.begin("go list", "go list", 0)
+	span.arg("args", strings.Join(args, " "))
+	defer span.end()
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(goEnv("-mod=readonly"), "GOPROXY=off")
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%s", bytes.TrimSpace(ee.Stderr))
+		}
+		return nil, errs.NewfWithCause(err, "go %s", strings.Join(args, " "))
+	}
+	var result []*module
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var one module
+		if err = decoder.Decode(&one); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errs.Wrap(err)
+		}
+		if one.Replace != nil {
+			if one.Replace.Dir != "" {
+				one.Dir = one.Replace.Dir
+			}
+			if one.Replace.Version != "" {
+				one.Version = one.Replace.Version
+			}
+		}
+		result = append(result, &one)
+	}
+	return result, nil
+}
+
+// listBuildModules returns the paths of the modules that provide packages to
+// the build of the main module's packages, including their tests. Only the
+// local module cache is consulted, so an error is returned if any of them are
+// missing from it.
+func listBuildModules() (map[string]bool, error) {
+	args := []string{"list", "-deps", "-test", "-f", "{{with .Module}}{{.Path}}{{end}}", "./..."}
+	span := runTrace.begin("go list", "go list", 0)
+	span.arg("args", strings.Join(args, " "))
+	defer span.end()
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(goEnv("-mod=readonly"), "GOPROXY=off")
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%s", bytes.TrimSpace(ee.Stderr))
+		}
+		return nil, errs.NewfWithCause(err, "go %s", strings.Join(args, " "))
+	}
+	result := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result[line] = true
+		}
+	}
+	return result, nil
+}
+
 func findRoot(in string) string {
 	pathSeparator := string([]rune{os.PathSeparator})
 	orig, err := filepath.Abs(in)
@@ -24,73 +24,217 @@ func main() {
 	fastOnly := false
 	onlyOne := false
 	forceInstall := false
+	reinstallMismatched := false
 	archive := false
-	var installFrom string
-	parallel := false
-	dryRun := false
+	var installFrom []string
+	dlOpts := downloadOptions{timeout: 10 * time.Minute, retries: 4}
+	var installFromProxy string
+	var proxyNoSumDB bool
+	var signKey string
+	var platforms []string
+	archiveFormat := ZipFormat
+	includeSelf := false
+	var trustKeys []string
 	goos := runtime.GOOS
 	goarch := runtime.GOARCH
-	var disallowedImports []string
-	var disallowedFunctions []string
+	var opts options
+
+	var groups []string
+	var definedGroups []string
+	var only []string
+	var skip []string
+	var linterTimeouts []string
+	var traceFile string
+	var profile string
+	prio := priority{nice: -1}
 
 	var buffer strings.Builder
-	buffer.WriteString(`Run linting checks against Go code. Two groups of linters are executed, a "fast" group and a "slow" group. The fast group consists of `)
-	for i, one := range FastLinters {
-		if i != 0 {
-			buffer.WriteString(", ")
-		}
-		buffer.WriteString(one.Name())
-	}
-	buffer.WriteString(`. The slow group consists of `)
-	for i, one := range SlowLinters {
-		if i != 0 {
-			buffer.WriteString(", ")
-		}
-		buffer.WriteString(one.Name())
+	buffer.WriteString(`Run linting checks against Go code. The linters are organized into groups, which may be selected with --group. Every linter is also a member of either the "fast" or the "slow" group.`)
+	members := builtinGroups()
+	for _, group := range groupNames() {
+		fmt.Fprintf(&buffer, " The %s group consists of %s.", group, strings.Join(members[group], ", "))
 	}
-	buffer.WriteByte('.')
 
 	cl := cmdline.New(true)
 	cl.Description = buffer.String()
-	cl.NewDurationOption(&timeout).SetSingle('t').SetName("timeout").SetArg("duration").SetUsage("Sets the timeout. If the linters run longer than this, they will be terminated and an error will be returned")
-	cl.NewBoolOption(&fastOnly).SetSingle('f').SetName("fast-only").SetUsage("When set, only the fast linters are run")
-	cl.NewBoolOption(&onlyOne).SetSingle('1').SetName("one").SetUsage("When set, only the last started invocation for the repo will complete; any others will be terminated")
+	cl.NewDurationOption(&timeout).SetSingle('t').SetName("timeout").SetArg("duration").SetUsage("Sets the overall timeout. If the linters run longer than this, they will be terminated and reported as tool failures, which results in an exit status of 2")
+	cl.NewStringArrayOption(&linterTimeouts).SetName("linter-timeout").SetArg("linter=duration").SetUsage("Sets the timeout for an individual linter, e.g. staticcheck=10m, overriding its default. A linter that runs longer than this is terminated and reported as a tool failure, which results in an exit status of 2. A duration of 0 removes the linter's own timeout. The timeout covers all of the linter's shards together and doesn't apply to linters run with --in-process. May be specified multiple times")
+	cl.NewBoolOption(&fastOnly).SetSingle('f').SetName("fast-only").SetUsage("When set, only the fast linters are run. May be combined with --group, --only and --skip")
+	cl.NewStringArrayOption(&groups).SetSingle('G').SetName("group").SetArg("name").SetUsage("Run only the linters in the specified group. May be a comma-separated list and may be specified multiple times")
+	cl.NewStringArrayOption(&definedGroups).SetName("define-group").SetArg("name=linter,...").SetUsage("Define a group containing the specified linters, for use with --group. May be specified multiple times")
+	cl.NewStringArrayOption(&only).SetSingle('o').SetName("only").SetArg("linter").SetUsage("Run only the specified linter, ignoring any --group. May be a comma-separated list and may be specified multiple times")
+	cl.NewStringArrayOption(&skip).SetSingle('s').SetName("skip").SetArg("linter").SetUsage("Do not run the specified linter. May be a comma-separated list and may be specified multiple times")
+	cl.NewBoolOption(&onlyOne).SetSingle('1').SetName("one").SetUsage("When set, only the last started invocation for the repo will complete; any others will be terminated. Also selects the background --profile, unless another is given")
 	cl.NewBoolOption(&forceInstall).SetSingle('F').SetName("force-install").SetUsage("When set, the linters will be reinstalled, then the process will exit")
-	cl.NewStringOption(&installFrom).SetName("install-from-archive").SetArg("url or path").SetUsage("When set, the linters will be installed by extracting them from the specified archive instead of building it from source, then the process will exit")
+	cl.NewBoolOption(&reinstallMismatched).SetName("reinstall-mismatched").SetUsage("When set, any installed linter whose version doesn't match its pinned version is reinstalled rather than just generating a warning")
+	cl.NewStringArrayOption(&installFrom).SetName("install-from-archive").SetArg("url or path").SetUsage("When set, the linters will be installed by extracting them from the specified archive instead of building it from source, then the process will exit. http, https and file URLs are supported, as are paths, which may start with ~. May be specified multiple times to provide mirrors, which are tried in order. Credentials for http and https URLs are taken from .netrc and the standard proxy environment variables are honored")
+	cl.NewDurationOption(&dlOpts.timeout).SetName("download-timeout").SetArg("duration").SetUsage("The time allowed for each attempt to download an archive for --install-from-archive")
+	cl.NewIntOption(&dlOpts.retries).SetName("download-retries").SetArg("count").SetUsage("The number of times a failed download for --install-from-archive is retried, with exponential backoff. Each retry resumes from where the previous attempt left off when the server supports it")
+	cl.NewStringOption(&dlOpts.checksum).SetName("archive-checksum").SetArg("sha256").SetUsage("The expected SHA-256 checksum of the archive given to --install-from-archive. Downloaded archives are cached by their checksum, so when this is set and a matching archive has been downloaded before, no download takes place")
+	cl.NewStringOption(&installFromProxy).SetName("install-from-proxy").SetArg("dir").SetUsage("When set, the pinned version of each selected linter will be built from the modules found in the specified file system GOPROXY directory, such as a mirror on a machine without internet access, then the process will exit. Modules are verified against the checksum database as usual, through the mirror if it contains one in its sumdb directory, honoring GOSUMDB, GONOSUMDB and GOPRIVATE. Use --proxy-no-sumdb to turn verification off instead")
+	cl.NewBoolOption(&proxyNoSumDB).SetName("proxy-no-sumdb").SetUsage("When set along with --install-from-proxy, turns off checksum database verification for every module, for mirrors without a sumdb directory on machines that can't reach the checksum database")
 	cl.NewBoolOption(&archive).SetName("archive").SetUsage("When set, creates an archive containing the linters that can be used later with --install-from-archive, then exits")
-	cl.NewStringOption(&goos).SetName("os").SetUsage("The GOOS value to use with the --archive option")
-	cl.NewStringOption(&goarch).SetName("arch").SetUsage("The GOARCH value to use with the --archive option")
-	cl.NewStringArrayOption(&disallowedImports).SetSingle('i').SetName("disallow-import").SetArg("import").SetUsage("Treat use of the specified import as an error. May be specified multiple times")
-	cl.NewStringArrayOption(&disallowedFunctions).SetSingle('d').SetName("disallow-function").SetArg("function").SetUsage("Treat use of the specified function as an error. May be specified multiple times")
-	cl.NewBoolOption(&parallel).SetSingle('p').SetName("parallel").SetUsage("When set, run the linters in parallel")
-	cl.NewBoolOption(&dryRun).SetSingle('n').SetName("dry-run").SetUsage("When set, just print the commands that would be issued and then exit")
-	cl.Parse(os.Args[1:])
+	cl.NewStringOption(&archiveFormat).SetName("archive-format").SetArg("format").SetUsage("The format of the archive created by --archive, either zip or tar.gz. The format of the archive given to --install-from-archive is detected automatically")
+	cl.NewBoolOption(&includeSelf).SetName("include-self").SetUsage("When set with --archive, a build of dirt is included in the archive for each platform, for use with 'self-update'. dirt is built from its source tree when run from within it, and otherwise from its module at the version that is running")
+	cl.NewStringOption(&signKey).SetName("sign-key").SetArg("path").SetUsage("When set with --archive, the archive's manifest is signed with the ed25519 private key found at the specified path. Use 'archive keygen' to create a key pair")
+	cl.NewStringArrayOption(&trustKeys).SetName("trust-key").SetArg("path").SetUsage("When set with --install-from-archive, the archive must be signed by the ed25519 public key found at the specified path, or nothing will be installed. May be specified multiple times, in which case a signature from any of the keys is accepted")
+	cl.NewStringOption(&goos).SetName("os").SetUsage("The GOOS value to use with the --archive option when --platforms isn't set")
+	cl.NewStringOption(&goarch).SetName("arch").SetUsage("The GOARCH value to use with the --archive option when --platforms isn't set")
+	cl.NewStringArrayOption(&platforms).SetName("platforms").SetArg("goos/goarch").SetUsage("The platforms to build the linters for with the --archive option, e.g. linux/amd64,darwin/arm64. All of them are placed into a single archive, from which --install-from-archive picks the one matching the machine. May be a comma-separated list and may be specified multiple times")
+	cl.NewStringArrayOption(&opts.disallowedImports).SetSingle('i').SetName("disallow-import").SetArg("import").SetUsage("Treat use of the specified import as an error. May be specified multiple times")
+	cl.NewStringArrayOption(&opts.disallowedFunctions).SetSingle('d').SetName("disallow-function").SetArg("function").SetUsage("Treat use of the specified function as an error. May be specified multiple times")
+	cl.NewBoolOption(&opts.checkLicenses).SetSingle('L').SetName("check-licenses").SetUsage("When set, the licenses of the modules the repo depends upon are located in the local module cache and any module with an unknown or denied license is treated as an error")
+	cl.NewStringArrayOption(&opts.deniedLicenses).SetName("deny-license").SetArg("spdx id").SetUsage("Treat a dependency using the specified license as an error when --check-licenses is set. A trailing '*' matches any suffix, so GPL-* denies all versions of the GPL. May be specified multiple times")
+	cl.NewStringOption(&opts.vulnDBPath).SetName("vuln-db").SetArg("path").SetUsage("When set, the modules the repo depends upon are checked against the OSV vulnerability database found in the specified directory or zip file")
+	cl.NewBoolOption(&opts.vulnCalledOnly).SetName("vuln-called-only").SetUsage("When set, vulnerabilities found with --vuln-db are only reported if the repo's own code uses the affected symbols")
+	cl.NewBoolOption(&opts.fix).SetName("fix").SetUsage("When set, problems found by the built-in checks that can be corrected automatically, such as an untidy go.mod, are fixed rather than reported")
+	cl.NewStringArrayOption(&opts.allowedGenerators).SetSingle('g').SetName("allow-generator").SetArg("name").SetUsage("Allow the generate check to run //go:generate directives using the specified generator, e.g. stringer or mockgen, in a scratch copy of the repo and report any generated files that are out of date. For directives of the form 'go run pkg', the name is the full package path, e.g. golang.org/x/tools/cmd/stringer, without any version. Commands given as a path and 'go run' directives using -exec or -toolexec are never run. May be specified multiple times")
+	cl.NewStringArrayOption(&opts.lintGenerated).SetName("lint-generated").SetArg("linter").SetUsage(`Files with a "Code generated ... DO NOT EDIT." header are normally excluded from @files and any problems reported within them are ignored. This includes them for the specified linter, e.g. gofmt. May be specified multiple times`)
+	cl.NewBoolOption(&opts.inProcess).SetSingle('P').SetName("in-process").SetUsage("When set, the linters that provide go/analysis analyzers, along with the disallow rules, are run within this process in a single pass, loading and type-checking the packages only once. Other linters are still run as separate processes")
+	cl.NewStringArrayOption(&opts.vetFlags).SetName("vet-flag").SetArg("flag").SetUsage("Pass the specified flag, e.g. -printf.funcs=Log or -composites=false, to go vet. May be specified multiple times. With --in-process, only flags that enable, disable or configure the vet analyzers are accepted")
+	cl.NewBoolOption(&opts.parallel).SetSingle('p').SetName("parallel").SetUsage("When set, run the linters in parallel")
+	cl.NewIntOption(&opts.jobs).SetSingle('j').SetName("jobs").SetArg("count").SetUsage("Sets the number of linters run at once with --parallel, which defaults to the number of CPUs. A count greater than 1 implies --parallel")
+	cl.NewIntOption(&opts.cpuBudget).SetName("cpu-budget").SetArg("count").SetUsage("When set, limits the number of CPUs used by the run. The linters running at once share the budget through GOMAXPROCS, each receiving at least 1, and no more linters than the budget are run at once")
+	cl.NewIntOption(&prio.nice).SetName("nice").SetArg("value").SetDefault("").SetUsage("When set, lowers the scheduling priority of dirt and the linters it runs to the specified nice value, from 1 to 19. A value of 0 leaves it unchanged, even with --profile")
+	cl.NewStringOption(&prio.ionice).SetName("ionice").SetArg("class").SetUsage("When set, lowers the I/O priority of dirt and the linters it runs. The class is either idle or best-effort, optionally followed by a level from 0 to 7, e.g. best-effort:7. Linux only")
+	cl.NewStringOption(&profile).SetName("profile").SetArg("name").SetUsage(fmt.Sprintf("Selects a resource profile, either %[1]s or %[2]s. The %[2]s profile, intended for runs triggered by an editor, runs one linter at a time with a quarter of the CPUs, a nice value of 19 and the idle I/O class. It is used by default with --one, while %[1]s is used otherwise. Options given explicitly take precedence over those of the profile", DefaultProfile, BackgroundProfile))
+	cl.NewIntOption(&opts.shards).SetName("shards").SetArg("count").SetUsage("When set along with --parallel, the package or file arguments of the linters that check each package or file independently, such as staticcheck, are split into the specified number of chunks, each run as a separate process. Their results are merged. Linters that analyze the repo as a whole, such as ineffassign and unconvert, are never split")
+	cl.NewBoolOption(&opts.stats).SetName("stats").SetUsage("When set, print a table of the wall time, CPU time, peak memory use (on Linux, sampled while the linter runs), findings and exit status of each linter after the run, along with totals and the parallel efficiency")
+	cl.NewStringOption(&opts.statsJSON).SetName("stats-json").SetArg("file").SetUsage("When set, write the statistics described for --stats to the specified file as JSON")
+	cl.NewStringOption(&traceFile).SetName("trace").SetArg("file").SetUsage("When set, write a timeline of the run to the specified file in the Chrome trace event format, for viewing in chrome://tracing or Perfetto. It shows each go list call, the built-in checks, linter installs and tool cache hits, and each linter, along with any timeouts. Each linter is shown on the lowest lane free when it started, so the lanes show how many linters ran at once rather than which worker ran each one")
+	cl.NewBoolOption(&opts.dryRun).SetSingle('n').SetName("dry-run").SetUsage("When set, just print the commands that would be issued and then exit")
+	commands := []cmdline.Cmd{
+		&lintersCmd{definedGroups: &definedGroups},
+		&gcCmd{},
+		&archiveCmd{},
+		&selfUpdateCmd{},
+		&doctorCmd{},
+	}
+	for _, one := range commands {
+		cl.AddCommand(one)
+	}
+	remaining := cl.Parse(os.Args[1:])
+	root := findRoot(".")
+	if err := usePinnedVersions(root); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: unable to determine the project's linter versions:", err)
+	}
+	// Other arguments, such as the "./..." editors pass, are ignored
+	if len(remaining) > 0 && isCommand(commands, remaining[0]) {
+		if err := cl.RunCommand(remaining); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			atexit.Exit(1)
+		}
+		atexit.Exit(0)
+	}
 
 	if archive {
-		if err := Archive(goos, goarch); err != nil {
+		if len(platforms) == 0 {
+			platforms = []string{goos + "/" + goarch}
+		}
+		if err := Archive(platforms, archiveFormat, signKey, includeSelf); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			atexit.Exit(1)
+		}
+		atexit.Exit(0)
+	}
+
+	if len(installFrom) > 0 {
+		if err := InstallFromArchive(installFrom, trustKeys, dlOpts); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			atexit.Exit(1)
 		}
+		recordTools(root)
 		atexit.Exit(0)
 	}
 
-	if installFrom != "" {
-		if err := InstallFromArchive(installFrom); err != nil {
+	if installFromProxy != "" {
+		selected, err := selectLinters(groups, definedGroups, only, skip, fastOnly)
+		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			atexit.Exit(1)
 		}
+		if err = InstallFromProxy(installFromProxy, selected, proxyNoSumDB); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			atexit.Exit(1)
+		}
+		recordTools(root)
 		atexit.Exit(0)
 	}
 
-	selected := selectLinters(fastOnly)
+	if traceFile != "" {
+		startTrace(traceFile)
+	}
+	if profile == "" && onlyOne {
+		// Runs triggered by an editor shouldn't compete with it for resources
+		profile = BackgroundProfile
+	}
+	if err := applyProfile(profile, &opts, &prio); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		atexit.Exit(1)
+	}
+	if err := prio.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		atexit.Exit(1)
+	}
+	if opts.jobs > 1 {
+		opts.parallel = true
+	}
+	if opts.cpuBudget > 0 {
+		runtime.GOMAXPROCS(opts.cpuBudget)
+	}
+	selected, err := selectLinters(groups, definedGroups, only, skip, fastOnly)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		atexit.Exit(1)
+	}
+	if opts.inProcess {
+		for _, one := range selected {
+			if one.Name() == "vet" && one.analyzers != nil {
+				if _, err = applyVetFlags(one.analyzers(), opts.vetFlags); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					atexit.Exit(1)
+				}
+			}
+		}
+	}
+	if opts.linterTimeouts, err = parseLinterTimeouts(linterTimeouts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		atexit.Exit(1)
+	}
+	if opts.inProcess {
+		for _, one := range selected {
+			if _, ok := opts.linterTimeouts[one.Name()]; ok && one.analyzers != nil {
+				fmt.Fprintf(os.Stderr, "Warning: the timeout for %s is ignored, since it is run in-process\n", one.Name())
+			}
+		}
+	}
+	if tc := activeToolchain(); tc.err != nil {
+		fmt.Fprintln(os.Stderr, tc.err)
+		atexit.Exit(1)
+	}
 	for _, one := range selected {
-		one.Install(forceInstall)
+		if err = one.CheckToolchain(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			atexit.Exit(1)
+		}
+	}
+	if err = prio.lower(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+	opts.prio = prio
+	if !opts.dryRun {
+		recordTools(root)
+	}
+	for _, one := range selected {
+		if !opts.inProcess || one.analyzers == nil {
+			one.Install(forceInstall, reinstallMismatched)
+		}
 	}
 	if forceInstall {
 		atexit.Exit(0)
 	}
 
-	l, err := newLint(selected, disallowedImports, disallowedFunctions, parallel, dryRun)
+	l, err := newLint(selected, opts)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		atexit.Exit(1)
@@ -120,3 +264,21 @@ func main() {
 
 	atexit.Exit(l.run(timeout))
 }
+
+// isCommand returns true if name is the name of one of the commands.
+func isCommand(commands []cmdline.Cmd, name string) bool {
+	for _, one := range commands {
+		if one.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTools records the linter versions the project rooted at root uses,
+// warning if that isn't possible.
+func recordTools(root string) {
+	if err := recordProjectTools(root); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: unable to record the project's linter versions:", err)
+	}
+}
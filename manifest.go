@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio"
+)
+
+// manifestName is the name of the entry within a linter archive that holds
+// its manifest.
+const manifestName = "manifest.json"
+
+// archiveManifest describes the contents of a linter archive.
+type archiveManifest struct {
+	// DirtVersion, if set, is the version of dirt included in the archive.
+	DirtVersion string            `json:"dirt_version,omitempty"`
+	Platforms   []archivePlatform `json:"platforms"`
+	// raw holds the manifest as it appears within the archive, which is
+	// what its signature covers.
+	raw []byte
+}
+
+// archivePlatform describes the linter binaries within a linter archive that
+// were built for a particular platform.
+type archivePlatform struct {
+	GOOS   string        `json:"goos"`
+	GOARCH string        `json:"goarch"`
+	Tools  []archiveTool `json:"tools"`
+	// Self, if set, describes the dirt binary for the platform.
+	Self *archiveTool `json:"self,omitempty"`
+}
+
+// archiveTool describes a linter binary within a linter archive.
+type archiveTool struct {
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	SHA256    string `json:"sha256"`
+}
+
+// newArchiveTool returns the manifest entry for the linter binary at path,
+// which will be stored in the archive as file.
+func newArchiveTool(lntr *linter, path, file string) (archiveTool, error) {
+	info := readBuildInfo(path)
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return archiveTool{}, err
+	}
+	return archiveTool{
+		Name:      lntr.Name(),
+		File:      file,
+		Module:    info.module,
+		Version:   info.version,
+		GoVersion: info.goVersion,
+		SHA256:    sum,
+	}, nil
+}
+
+// readArchiveManifest returns the manifest within the linter archive.
+func readArchiveManifest(ar archiveReader) (*archiveManifest, error) {
+	if !ar.has(manifestName) {
+		return nil, fmt.Errorf("The archive has no manifest. Re-create it with this version of %s", cmdline.AppCmdName)
+	}
+	r, err := ar.open(manifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer xio.CloseIgnoringErrors(r)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var manifest archiveManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("Unable to parse the archive manifest: %v", err)
+	}
+	manifest.raw = data
+	return &manifest, nil
+}
+
+// parsePlatforms returns the platforms specified as "goos/goarch", with any
+// duplicates removed, in sorted order so that the archive's layout doesn't
+// depend on the order they were specified in.
+func parsePlatforms(platforms []string) ([]archivePlatform, error) {
+	seen := make(map[string]bool)
+	var result []archivePlatform
+	for _, one := range splitList(platforms) {
+		parts := strings.Split(one, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid platform %s. Platforms must be specified as goos/goarch, e.g. linux/amd64", one)
+		}
+		if !seen[one] {
+			seen[one] = true
+			result = append(result, archivePlatform{GOOS: parts[0], GOARCH: parts[1]})
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("No platforms were specified")
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].dir() < result[j].dir() })
+	return result, nil
+}
+
+// dir returns the directory within a linter archive that holds the
+// platform's binaries.
+func (p *archivePlatform) dir() string {
+	return p.GOOS + "_" + p.GOARCH
+}
+
+// platform returns the platform within the manifest matching goos and goarch,
+// or nil if there is none.
+func (m *archiveManifest) platform(goos, goarch string) *archivePlatform {
+	for i := range m.Platforms {
+		if m.Platforms[i].GOOS == goos && m.Platforms[i].GOARCH == goarch {
+			return &m.Platforms[i]
+		}
+	}
+	return nil
+}
+
+// platformList returns a comma-separated list of the platforms within the
+// manifest.
+func (m *archiveManifest) platformList() string {
+	list := make([]string, len(m.Platforms))
+	for i := range m.Platforms {
+		list[i] = m.Platforms[i].GOOS + "/" + m.Platforms[i].GOARCH
+	}
+	return strings.Join(list, ", ")
+}
+
+// verify checks that every tool for the platform is present within the
+// linter archive and matches its checksum.
+func (p *archivePlatform) verify(ar archiveReader) error {
+	for i := range p.Tools {
+		if err := p.Tools[i].verify(ar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verify checks that the tool is present within the linter archive and
+// matches its checksum.
+func (t *archiveTool) verify(ar archiveReader) error {
+	if !ar.has(t.File) {
+		return fmt.Errorf("The archive is missing %s for %s", t.File, t.Name)
+	}
+	r, err := ar.open(t.File)
+	if err != nil {
+		return err
+	}
+	sum, err := readerSHA256(r)
+	xio.CloseIgnoringErrors(r)
+	if err != nil {
+		return err
+	}
+	if sum != t.SHA256 {
+		return fmt.Errorf("The checksum of %s within the archive is %s, but the manifest expects %s", t.File, sum, t.SHA256)
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer xio.CloseIgnoringErrors(f)
+	return readerSHA256(f)
+}
+
+func readerSHA256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
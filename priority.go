@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Resource profiles, selected with --profile.
+const (
+	DefaultProfile    = "default"
+	BackgroundProfile = "background"
+)
+
+// I/O scheduling classes, as used by ionice.
+const (
+	ioClassBestEffort = 2
+	ioClassIdle       = 3
+)
+
+// priority holds the scheduling priority dirt and the linters it spawns run
+// with.
+type priority struct {
+	// nice is the niceness, from 0 to 19, with 0 leaving it unchanged. It is
+	// -1 until set, so that a profile can tell whether it was given
+	// explicitly.
+	nice int
+	// ionice is the I/O scheduling class and optional level, e.g. "idle" or
+	// "best-effort:7", with an empty string leaving it unchanged.
+	ionice string
+}
+
+// applyProfile fills in the concurrency and priority settings provided by the
+// named profile that weren't set explicitly. The background profile, intended
+// for runs triggered by an editor and used by default with --one, runs one
+// linter at a time with a quarter of the CPUs at the lowest priority.
+func applyProfile(name string, opts *options, prio *priority) error {
+	switch name {
+	case "", DefaultProfile:
+	case BackgroundProfile:
+		if opts.jobs == 0 {
+			opts.jobs = 1
+		}
+		if opts.cpuBudget == 0 {
+			if opts.cpuBudget = runtime.NumCPU() / 4; opts.cpuBudget < 1 {
+				opts.cpuBudget = 1
+			}
+		}
+		if prio.nice < 0 && runtime.GOOS != "windows" {
+			prio.nice = 19
+		}
+		if prio.ionice == "" && runtime.GOOS == "linux" {
+			prio.ionice = "idle"
+		}
+	default:
+		return fmt.Errorf("Unknown profile %s. Use %s or %s", name, DefaultProfile, BackgroundProfile)
+	}
+	return nil
+}
+
+// validate returns an error if the requested priority is invalid.
+func (p priority) validate() error {
+	if p.nice < -1 || p.nice > 19 {
+		return fmt.Errorf("Invalid nice value %d. It must be from 0 to 19", p.nice)
+	}
+	if p.ionice != "" {
+		if _, _, err := parseIONice(p.ionice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lower lowers the priority of dirt to that requested, which the linters and
+// installs it spawns inherit.
+func (p priority) lower() error {
+	return p.applyTo(0)
+}
+
+// applyTo sets the priority of the process with the pid, or of dirt itself if
+// pid is 0, to that requested.
+func (p priority) applyTo(pid int) error {
+	if p.nice > 0 {
+		if err := setNice(pid, p.nice); err != nil {
+			return fmt.Errorf("Unable to set the nice value: %v", err)
+		}
+	}
+	if p.ionice != "" {
+		class, level, err := parseIONice(p.ionice)
+		if err != nil {
+			return err
+		}
+		if err = setIOPriority(pid, class, level); err != nil {
+			return fmt.Errorf("Unable to set the I/O priority: %v", err)
+		}
+	}
+	return nil
+}
+
+// start starts the command with the requested priority. Since a new process
+// inherits the priority of the thread that creates it, and threads the Go
+// runtime has created since dirt lowered its own priority may not have been
+// lowered, the command is started from a thread whose priority has just been
+// set. The priority of the command is then set directly as well.
+func (p priority) start(cmd *exec.Cmd) error {
+	if p.nice <= 0 && p.ionice == "" {
+		return cmd.Start()
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	p.lowerThread() // @allow
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// The command may already have exited, so failures are ignored
+	p.applyTo(cmd.Process.Pid) // @allow
+	return nil
+}
+
+// parseIONice returns the I/O scheduling class and level for a specification
+// of the form "idle" or "best-effort[:level]", where the level is from 0 to 7
+// and defaults to 7, the lowest.
+func parseIONice(spec string) (class, level int, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	switch strings.ToLower(strings.TrimSpace(parts[0])) {
+	case "idle", "3":
+		if len(parts) > 1 {
+			return 0, 0, fmt.Errorf("The idle I/O class doesn't take a level: %s", spec)
+		}
+		return ioClassIdle, 0, nil
+	case "best-effort", "be", "2":
+		level = 7
+		if len(parts) > 1 {
+			if level, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || level < 0 || level > 7 {
+				return 0, 0, fmt.Errorf("Invalid I/O priority level in %s. It must be from 0 to 7", spec)
+			}
+		}
+		return ioClassBestEffort, level, nil
+	default:
+		return 0, 0, fmt.Errorf("Invalid I/O priority %s. Use idle or best-effort[:level]", spec)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"syscall"
+)
+
+// ioprioWhoProcess selects a single thread as the target of ioprio_set.
+const ioprioWhoProcess = 1
+
+// setNice sets the niceness of every thread of the process with the pid, or
+// of dirt if pid is 0. Linux applies it per thread, and a new thread or
+// process inherits it from the thread that created it.
+func setNice(pid, nice int) error {
+	return forEachThread(pid, func(tid int) error {
+		return setThreadNice(tid, nice)
+	})
+}
+
+func setThreadNice(tid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice)
+}
+
+// setIOPriority sets the I/O scheduling class and level of every thread of
+// the process with the pid, or of dirt if pid is 0.
+func setIOPriority(pid, class, level int) error {
+	return forEachThread(pid, func(tid int) error {
+		return setThreadIOPriority(tid, class, level)
+	})
+}
+
+func setThreadIOPriority(tid, class, level int) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(class<<13|level)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// lowerThread sets the priority of the calling thread alone, which the caller
+// must have locked its goroutine to.
+func (p priority) lowerThread() error {
+	tid := syscall.Gettid()
+	if p.nice > 0 {
+		if err := setThreadNice(tid, p.nice); err != nil {
+			return err
+		}
+	}
+	if p.ionice != "" {
+		class, level, err := parseIONice(p.ionice)
+		if err != nil {
+			return err
+		}
+		return setThreadIOPriority(tid, class, level)
+	}
+	return nil
+}
+
+func forEachThread(pid int, fn func(tid int) error) error {
+	dir := "/proc/self/task"
+	if pid != 0 {
+		dir = "/proc/" + strconv.Itoa(pid) + "/task"
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, one := range entries {
+		if tid, cerr := strconv.Atoi(one.Name()); cerr == nil {
+			if err = fn(tid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
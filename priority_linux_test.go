@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// priorityChildEnv is set when the test binary is re-run to perform the
+// priority check, so that lowering the priority doesn't affect other tests.
+const priorityChildEnv = "DIRT_TEST_PRIORITY_CHILD"
+
+func TestPriorityStart(t *testing.T) {
+	if os.Getenv(priorityChildEnv) == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestPriorityStart$")
+		cmd.Env = append(os.Environ(), priorityChildEnv+"=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+	cmd := exec.Command("sleep", "1")
+	if err := (priority{nice: 5}).start(cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait() // @allow
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(cmd.Process.Pid) + "/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command name is parenthesized and may contain spaces, so the fields
+	// are counted from the closing parenthesis, after which the nice value is
+	// the 17th field.
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	if len(fields) < 17 {
+		t.Fatalf("unexpected stat format: %s", data)
+	}
+	if fields[16] != "5" {
+		t.Errorf("expected the command to run with a nice value of 5, got %s", fields[16])
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
+
+func setIOPriority(pid, class, level int) error {
+	return errors.New("ionice is only supported on Linux")
+}
+
+// lowerThread does nothing, as the priority applies to the process as a whole
+// and was already set by lower.
+func (p priority) lowerThread() error {
+	return nil
+}
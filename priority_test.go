@@ -0,0 +1,32 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestApplyProfile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("nice is not supported on Windows")
+	}
+	for _, one := range []struct {
+		nice     int
+		expected int
+	}{
+		{nice: -1, expected: 19},
+		{nice: 0, expected: 0},
+		{nice: 5, expected: 5},
+	} {
+		var opts options
+		prio := priority{nice: one.nice}
+		if err := applyProfile(BackgroundProfile, &opts, &prio); err != nil {
+			t.Fatal(err)
+		}
+		if prio.nice != one.expected {
+			t.Errorf("with an explicit nice value of %d, expected %d, got %d", one.nice, one.expected, prio.nice)
+		}
+		if err := prio.validate(); err != nil {
+			t.Error(err)
+		}
+	}
+}
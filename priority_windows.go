@@ -0,0 +1,17 @@
+package main
+
+import "errors"
+
+func setNice(pid, nice int) error {
+	return errors.New("nice is not supported on Windows")
+}
+
+func setIOPriority(pid, class, level int) error {
+	return errors.New("ionice is not supported on Windows")
+}
+
+// lowerThread does nothing, as the priority applies to the process as a whole
+// and was already set by lower.
+func (p priority) lowerThread() error {
+	return nil
+}
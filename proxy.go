@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/xio/fs"
+	modmodule "golang.org/x/mod/module"
+)
+
+// InstallFromProxy attempts to install the specified linters by building
+// their pinned versions from the modules found in a file system GOPROXY, such
+// as one mirrored onto a machine without internet access. The checksum
+// database is consulted as the user's environment directs, unless noSumDB is
+// set.
+func InstallFromProxy(dir string, linters []linter, noSumDB bool) error {
+	if !activeToolchain().supportsModuleInstall() {
+		return fmt.Errorf("Installing from a module proxy requires go1.16 or later, but the active toolchain is %s", goVersion())
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !fs.IsDir(abs) {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	proxyURL := fileURL(abs)
+	env := append(goEnv("-mod=mod"), "GOPROXY="+proxyURL, "GOTOOLCHAIN=local")
+	if noSumDB {
+		env = append(env, "GOSUMDB=off")
+	}
+	hasSumDB := fs.IsDir(filepath.Join(abs, "sumdb"))
+	failed := 0
+	for i := range linters {
+		one := &linters[i]
+		if one.pkg == "" {
+			continue
+		}
+		cmd, cerr := one.moduleInstallCmd(env)
+		if cerr != nil {
+			return cerr
+		}
+		if data, rerr := cmd.CombinedOutput(); rerr != nil {
+			failed++
+			fmt.Fprintln(os.Stderr, "Unable to install", one.Name())
+			if missing := missingModules(string(data), proxyURL); len(missing) > 0 {
+				for _, m := range missing {
+					fmt.Fprintf(os.Stderr, "  %s is missing from the mirror at %s\n", m, abs)
+				}
+			} else {
+				fmt.Fprint(os.Stderr, string(data))
+				if !noSumDB && !hasSumDB && strings.Contains(string(data), "verifying") {
+					fmt.Fprintf(os.Stderr, "  The mirror at %s has no sumdb directory. Add one, exempt the modules with GONOSUMDB or use --proxy-no-sumdb\n", abs)
+				}
+			}
+			continue
+		}
+		fmt.Println("Installed", one.Name(), one.version, "from", proxyURL)
+	}
+	if failed != 0 {
+		return fmt.Errorf("Unable to install %d linter(s) from %s", failed, abs)
+	}
+	return nil
+}
+
+// fileURL returns the file URL for the absolute path.
+func fileURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths start with a drive letter
+		path = "/" + path
+	}
+	return "file://" + path
+}
+
+// missingModules returns the modules, along with their versions when known,
+// that the go command's output reports it was unable to read from the proxy.
+func missingModules(output, proxyURL string) []string {
+	prefix := strings.TrimSuffix(proxyURL, "/") + "/"
+	seen := make(map[string]bool)
+	var missing []string
+	for _, line := range strings.Split(output, "\n") {
+		for {
+			i := strings.Index(line, prefix)
+			if i == -1 {
+				break
+			}
+			line = line[i+len(prefix):]
+			end := strings.IndexAny(line, ": \t")
+			if end == -1 {
+				end = len(line)
+			}
+			if m := proxyFileModule(line[:end]); m != "" && !seen[m] {
+				seen[m] = true
+				missing = append(missing, m)
+			}
+			line = line[end:]
+		}
+	}
+	return missing
+}
+
+// proxyFileModule returns the module, and version if present, that the
+// specified file within a GOPROXY describes, e.g. "example.com/mod@v1.2.3"
+// for "example.com/mod/@v/v1.2.3.zip" or "example.com/mod (version list)" for
+// "example.com/mod/@v/list".
+func proxyFileModule(file string) string {
+	if strings.HasSuffix(file, "/@latest") {
+		if modPath, err := modmodule.UnescapePath(strings.TrimSuffix(file, "/@latest")); err == nil {
+			return modPath + " (latest version)"
+		}
+		return ""
+	}
+	parts := strings.SplitN(file, "/@v/", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	modPath, err := modmodule.UnescapePath(parts[0])
+	if err != nil {
+		return ""
+	}
+	if parts[1] == "list" {
+		return modPath + " (version list)"
+	}
+	ext := filepath.Ext(parts[1])
+	switch ext {
+	case ".info", ".mod", ".zip":
+	default:
+		return modPath
+	}
+	version, err := modmodule.UnescapeVersion(strings.TrimSuffix(parts[1], ext))
+	if err != nil {
+		return modPath
+	}
+	return modPath + "@" + version
+}
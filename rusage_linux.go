@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/richardwilkes/toolbox/xio"
+)
+
+// memorySampleInterval is how often the peak memory use of a linter is
+// sampled.
+const memorySampleInterval = 25 * time.Millisecond
+
+// watchMemory starts sampling the peak resident set size of the process, which
+// Linux reports as VmHWM in /proc/<pid>/status and resets when the process
+// execs. The ru_maxrss value from the process's resource usage isn't used, as
+// it includes the memory dirt itself was using when it forked the process. The
+// returned function stops sampling and returns the largest value seen, in
+// bytes. As the value can't be read once the process has exited, a peak
+// reached just before then may be missed.
+func watchMemory(pid int) func() int64 {
+	var peak int64
+	sample := func() {
+		if v := peakRSS(pid); v > atomic.LoadInt64(&peak) {
+			atomic.StoreInt64(&peak, v)
+		}
+	}
+	sample()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sample()
+			}
+		}
+	}()
+	return func() int64 {
+		close(done)
+		<-finished
+		return atomic.LoadInt64(&peak)
+	}
+}
+
+// peakRSS returns the VmHWM value of the process, in bytes, or zero if it
+// can't be read.
+func peakRSS(pid int) int64 {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		return 0
+	}
+	defer xio.CloseIgnoringErrors(f)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "VmHWM:") {
+			// Linux reports the size in kilobytes
+			fields := strings.Fields(line[len("VmHWM:"):])
+			if len(fields) > 0 {
+				if kb, perr := strconv.ParseInt(fields[0], 10, 64); perr == nil {
+					return kb * 1024
+				}
+			}
+			return 0
+		}
+	}
+	return 0
+}
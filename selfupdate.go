@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio"
+)
+
+// buildSelf builds dirt for the specified platform, returning the path to the
+// resulting binary and its version. When run from within dirt's own source
+// tree, that source is built. Otherwise, a released version of dirt is rebuilt
+// from its module at the same version.
+func buildSelf(goos, goarch, tmpDir string) (exePath, version string, err error) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", "", fmt.Errorf("Unable to determine how %s was built", cmdline.AppCmdName)
+	}
+	self := linter{cmd: path.Base(info.Path), pkg: info.Path}
+	if out, lerr := exec.Command("go", "list", "-m").Output(); lerr == nil && strings.TrimSpace(string(out)) == info.Main.Path {
+		var dir []byte
+		if dir, err = exec.Command("go", "list", "-f", "{{.Dir}}", info.Path).Output(); err != nil {
+			return "", "", fmt.Errorf("Unable to locate the source of %s: %v", cmdline.AppCmdName, err)
+		}
+		if version, err = sourceAppVersion(strings.TrimSpace(string(dir))); err != nil {
+			return "", "", err
+		}
+		p := filepath.Join(tmpDir, "self", exeName(self.cmd, goos))
+		cmd := exec.Command("go", append(append([]string{"build"}, reproducibleBuildFlags...), "-o", p, info.Path)...)
+		cmd.Env = crossBuildEnv(goos, goarch)
+		if data, berr := cmd.CombinedOutput(); berr != nil {
+			return "", "", fmt.Errorf("Unable to build %s\n%s", cmdline.AppCmdName, string(data))
+		}
+		return p, version, nil
+	}
+	if v := info.Main.Version; v == "" || v == "(devel)" || strings.HasSuffix(v, "+dirty") {
+		return "", "", fmt.Errorf("%s was built from source, so it can only be included in an archive created from within its source tree", cmdline.AppCmdName)
+	}
+	self.version = info.Main.Version
+	if exePath, err = self.build(goos, goarch, filepath.Join(tmpDir, "self")); err != nil {
+		return "", "", err
+	}
+	// The same release is rebuilt, so its version is the one running
+	return exePath, cmdline.AppVersion, nil
+}
+
+// sourceAppVersion returns the version the source of dirt's main package in
+// dir assigns to cmdline.AppVersion.
+func sourceAppVersion(dir string) (string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return "", err
+	}
+	version := ""
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(node ast.Node) bool {
+			assign, ok := node.(*ast.AssignStmt)
+			if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+				return true
+			}
+			if sel, ok := assign.Lhs[0].(*ast.SelectorExpr); ok && sel.Sel.Name == "AppVersion" {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Name == "cmdline" {
+					if lit, ok := assign.Rhs[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						version, _ = strconv.Unquote(lit.Value) // @allow
+					}
+				}
+			}
+			return true
+		})
+	}
+	if version == "" {
+		return "", fmt.Errorf("Unable to determine the version of the %s source in %s", cmdline.AppCmdName, dir)
+	}
+	return version, nil
+}
+
+type selfUpdateCmd struct {
+	from      []string
+	trustKeys []string
+	dlOpts    downloadOptions
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *selfUpdateCmd) Name() string {
+	return "self-update"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *selfUpdateCmd) Usage() string {
+	return "Replace this executable with the newer version found in a linter archive created with --archive --include-self."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *selfUpdateCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	c.dlOpts = downloadOptions{timeout: 10 * time.Minute, retries: 4}
+	cl.NewStringArrayOption(&c.from).SetName("from").SetArg("url or path").SetUsage("The archive to update from. May be specified multiple times to provide mirrors, which are tried in order")
+	cl.NewStringArrayOption(&c.trustKeys).SetName("trust-key").SetArg("path").SetUsage("The archive must be signed by the ed25519 public key found at the specified path. May be specified multiple times, in which case a signature from any of the keys is accepted. Either this or --archive-checksum is required")
+	cl.NewStringOption(&c.dlOpts.checksum).SetName("archive-checksum").SetArg("sha256").SetUsage("The expected SHA-256 checksum of the archive. Either this or --trust-key is required")
+	cl.Parse(args)
+	if len(c.from) == 0 {
+		return errors.New("An archive must be specified with --from")
+	}
+	if len(c.trustKeys) == 0 && c.dlOpts.checksum == "" {
+		// The checksums within the manifest prove nothing unless the manifest
+		// itself can be trusted.
+		return errors.New("The archive must be verified with --trust-key or --archive-checksum")
+	}
+	keys := make([]ed25519.PublicKey, 0, len(c.trustKeys))
+	for _, one := range c.trustKeys {
+		key, err := loadPublicKey(one)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	archivePath, err := fetchArchive(c.from, c.dlOpts)
+	if err != nil {
+		return err
+	}
+	ar, err := openArchive(archivePath)
+	if err != nil {
+		return err
+	}
+	defer xio.CloseIgnoringErrors(ar)
+	manifest, err := readArchiveManifest(ar)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err = manifest.verifySignature(ar, keys); err != nil {
+			return err
+		}
+	}
+	platform := manifest.platform(runtime.GOOS, runtime.GOARCH)
+	if manifest.DirtVersion == "" || platform == nil || platform.Self == nil {
+		return fmt.Errorf("The archive does not contain %s for %s/%s", cmdline.AppCmdName, runtime.GOOS, runtime.GOARCH)
+	}
+	if compareSemver(manifest.DirtVersion, cmdline.AppVersion) <= 0 {
+		fmt.Printf("%s %s is already up to date; the archive contains %s\n", cmdline.AppCmdName, cmdline.AppVersion, manifest.DirtVersion)
+		return nil
+	}
+	if err = platform.Self.verify(ar); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err = replaceExecutable(ar, platform.Self.File, exe); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s from %s to %s\n", cmdline.AppCmdName, cmdline.AppVersion, manifest.DirtVersion)
+	return nil
+}
+
+// replaceExecutable atomically replaces the executable at exe with the named
+// entry from the archive.
+func replaceExecutable(ar archiveReader, name, exe string) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(exe), "."+filepath.Base(exe))
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmp) // @allow
+		}
+	}()
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = copyFileFromArchive(ar, name, tmp); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		return os.Rename(tmp, exe)
+	}
+	// A running executable can't be replaced on Windows, but it can be
+	// renamed out of the way.
+	old := exe + ".old"
+	os.Remove(old) // @allow
+	if err = os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return fmt.Errorf("%v; additionally, the original executable could not be restored from %s: %v", err, old, rerr)
+		}
+		return err
+	}
+	return nil
+}
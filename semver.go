@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareSemver compares two semantic versions, returning -1, 0 or 1. The
+// leading "v" is optional and build metadata, such as "+incompatible", is
+// ignored. Pseudo-versions sort correctly since they are encoded as
+// pre-release versions.
+func compareSemver(a, b string) int {
+	aCore, aPre := splitSemver(a)
+	bCore, bPre := splitSemver(b)
+	for i := 0; i < 3; i++ {
+		if c := compareNumeric(aCore[i], bCore[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case aPre == "" && bPre == "":
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	aParts := strings.Split(aPre, ".")
+	bParts := strings.Split(bPre, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if c := comparePrereleaseIdentifier(aParts[i], bParts[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(aParts), len(bParts))
+}
+
+func splitSemver(v string) (core [3]string, pre string) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(v, '+'); i != -1 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i != -1 {
+		pre = v[i+1:]
+		v = v[:i]
+	}
+	core = [3]string{"0", "0", "0"}
+	for i, one := range strings.SplitN(v, ".", 3) {
+		core[i] = one
+	}
+	return core, pre
+}
+
+func comparePrereleaseIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareUint(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if c := compareInt(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
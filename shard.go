@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// commandLineHeadroom is the number of bytes of the command line budget left
+// unused, as a safety margin.
+const commandLineHeadroom = 4096
+
+// shard identifies the portion of a linter's package, file or directory
+// arguments handled by a single process, when the linter is split across
+// workers with --shards or its arguments won't fit on one command line.
+type shard struct {
+	index int
+	count int
+	lo    int
+	hi    int
+}
+
+// label returns the name used to refer to the linter's shard in timeouts,
+// statistics and traces.
+func (s shard) label(name string) string {
+	if s.count < 2 {
+		return name
+	}
+	return fmt.Sprintf("%s (shard %d/%d)", name, s.index+1, s.count)
+}
+
+// portion returns the shard's contiguous portion of list.
+func (s shard) portion(list []string) []string {
+	if s.count < 2 {
+		return list
+	}
+	return list[s.lo:s.hi]
+}
+
+// linterShards returns the shards the linter should be run as. Linters marked
+// as shardable are split into --shards pieces when --parallel is also set,
+// but never into more shards than there are arguments to split. Any linter is
+// split further where its arguments would otherwise exceed the platform's
+// limit on the length of a command line. A linter that takes @files has no
+// shards when there are no files for it.
+func (l *lint) linterShards(lntr linter) []shard {
+	for _, arg := range lntr.Args() {
+		// Given no files, linters such as gofmt would read from stdin, so a
+		// linter that takes @files isn't run when there are none for it.
+		if arg == FILES && len(l.linterFiles(lntr)) == 0 {
+			return nil
+		}
+	}
+	list := l.shardedArgs(lntr)
+	count := 1
+	if l.parallel && l.shards > 1 && lntr.shardable {
+		if len(list) < l.shards {
+			count = len(list)
+		} else {
+			count = l.shards
+		}
+	}
+	if count < 1 {
+		count = 1
+	}
+	budget := commandLineBudget() - commandLineHeadroom - argsSize(l.argSubstitution(lntr, shard{})) + argsSize(list) - argSize(lntr.cmd)
+	var shards []shard
+	for i := 0; i < count; i++ {
+		lo := i * len(list) / count
+		hi := (i + 1) * len(list) / count
+		size := 0
+		for j := lo; j < hi; j++ {
+			one := argSize(list[j])
+			if j > lo && size+one > budget {
+				shards = append(shards, shard{lo: lo, hi: j})
+				lo = j
+				size = 0
+			}
+			size += one
+		}
+		shards = append(shards, shard{lo: lo, hi: hi})
+	}
+	for i := range shards {
+		shards[i].index = i
+		shards[i].count = len(shards)
+	}
+	return shards
+}
+
+// argsSize returns the number of bytes the arguments occupy when passed to a
+// new process.
+func argsSize(args []string) int {
+	size := 0
+	for _, arg := range args {
+		size += argSize(arg)
+	}
+	return size
+}
+
+// argSize returns the number of bytes the argument occupies when passed to a
+// new process, which includes its terminator and the pointer to it.
+func argSize(arg string) int {
+	return len(arg) + 1 + 8
+}
+
+// environmentSize returns the number of bytes the environment occupies when
+// passed to a new process.
+func environmentSize() int {
+	return argsSize(os.Environ())
+}
+
+// shardedArgs returns the arguments that are split across shards, which are
+// those substituted for the first of @pkgs, @files or @dirs in the linter's
+// arguments.
+func (l *lint) shardedArgs(lntr linter) []string {
+	for _, arg := range lntr.Args() {
+		switch arg {
+		case PKGS:
+			return l.pkgs
+		case FILES:
+			return l.linterFiles(lntr)
+		case DIRS:
+			return l.dirs
+		}
+	}
+	return nil
+}
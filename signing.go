@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/xio"
+)
+
+// signatureName is the name of the entry within a linter archive that holds
+// the detached signature of its manifest.
+const signatureName = "manifest.sig"
+
+// signManifest returns the base64-encoded ed25519 signature of the manifest
+// data.
+func signManifest(key ed25519.PrivateKey, data []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+}
+
+// verifySignature checks that the linter archive contains a signature of the
+// manifest made by one of the keys.
+func (m *archiveManifest) verifySignature(ar archiveReader, keys []ed25519.PublicKey) error {
+	if !ar.has(signatureName) {
+		return errors.New("The archive is not signed, but a trusted key was specified")
+	}
+	r, err := ar.open(signatureName)
+	if err != nil {
+		return err
+	}
+	defer xio.CloseIgnoringErrors(r)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("The archive's signature is malformed")
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, m.raw, sig) {
+			return nil
+		}
+	}
+	return errors.New("The archive's signature was not made by any of the trusted keys")
+}
+
+// generateKeyPair creates a new ed25519 key pair, returning the PEM encodings
+// of the private and public keys.
+func generateKeyPair() (private, public []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
+
+// loadPrivateKey returns the ed25519 private key stored in the PEM-encoded
+// PKCS #8 file at path, such as those created by 'archive keygen' or
+// "openssl genpkey -algorithm ed25519".
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the private key in %s: %v", path, err)
+	}
+	if priv, ok := key.(ed25519.PrivateKey); ok {
+		return priv, nil
+	}
+	return nil, fmt.Errorf("%s does not contain an ed25519 private key", path)
+}
+
+// loadPublicKey returns the ed25519 public key stored in the PEM-encoded PKIX
+// file at path.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the public key in %s: %v", path, err)
+	}
+	if pub, ok := key.(ed25519.PublicKey); ok {
+		return pub, nil
+	}
+	return nil, fmt.Errorf("%s does not contain an ed25519 public key", path)
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM-encoded %s", path, strings.ToLower(blockType))
+	}
+	return block.Bytes, nil
+}
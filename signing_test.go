@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio/fs"
+)
+
+const testToolData = "pretend shadow binary"
+
+func TestKeygen(t *testing.T) {
+	dir := t.TempDir()
+	priv, pub := generateTestKeys(t, dir, "release")
+	if fi, err := os.Stat(priv); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("the private key has permissions %v, expected 0600", fi.Mode().Perm())
+	}
+	privKey, err := loadPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := loadPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pubKey.Equal(privKey.Public()) {
+		t.Error("the public key doesn't match the private key")
+	}
+	if err = (&archiveKeygenCmd{}).Run(cmdline.New(false), []string{filepath.Join(dir, "release")}); err == nil {
+		t.Error("keygen overwrote an existing key pair")
+	}
+}
+
+func TestInstallFromSignedArchive(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", dir)
+	t.Setenv("NETRC", filepath.Join(dir, "netrc"))
+	priv, pub := generateTestKeys(t, dir, "release")
+	_, otherPub := generateTestKeys(t, dir, "other")
+	serveDir := filepath.Join(dir, "serve")
+	if err := os.MkdirAll(serveDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(serveDir)))
+	defer server.Close()
+	lntr := findLinter("shadow")
+	for _, one := range []struct {
+		name      string
+		signKey   string
+		tamper    bool
+		trustKeys []string
+		failure   string
+	}{
+		{name: "signed", signKey: priv, trustKeys: []string{pub}},
+		{name: "any-trusted-key", signKey: priv, trustKeys: []string{otherPub, pub}},
+		{name: "unsigned-untrusted", trustKeys: nil},
+		{name: "tampered", signKey: priv, tamper: true, trustKeys: []string{pub}, failure: "not made by any of the trusted keys"},
+		{name: "wrong-key", signKey: priv, trustKeys: []string{otherPub}, failure: "not made by any of the trusted keys"},
+		{name: "missing-signature", trustKeys: []string{pub}, failure: "not signed"},
+	} {
+		t.Run(one.name, func(t *testing.T) {
+			if err := os.RemoveAll(cacheDir); err != nil {
+				t.Fatal(err)
+			}
+			writeTestArchive(t, filepath.Join(serveDir, one.name+".zip"), lntr, one.signKey, one.tamper)
+			err := InstallFromArchive([]string{server.URL + "/" + one.name + ".zip"}, one.trustKeys, downloadOptions{timeout: 10 * time.Second})
+			toolDir, derr := lntr.toolDir()
+			if derr != nil {
+				t.Fatal(derr)
+			}
+			installed := fs.FileExists(filepath.Join(toolDir, exeName(lntr.cmd, runtime.GOOS)))
+			if one.failure != "" {
+				if err == nil || !strings.Contains(err.Error(), one.failure) {
+					t.Errorf("expected an error containing %q, got %v", one.failure, err)
+				}
+				if installed {
+					t.Error("the linter was installed from an archive that failed verification")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !installed {
+				t.Error("the linter was not installed")
+			}
+		})
+	}
+}
+
+// generateTestKeys creates a key pair named name within dir using the keygen
+// command, returning the paths to the private and public keys.
+func generateTestKeys(t *testing.T, dir, name string) (priv, pub string) {
+	t.Helper()
+	base := filepath.Join(dir, name)
+	if err := (&archiveKeygenCmd{}).Run(cmdline.New(false), []string{base}); err != nil {
+		t.Fatal(err)
+	}
+	return base + ".key", base + ".pub"
+}
+
+// writeTestArchive writes a zip linter archive containing a stand-in binary for
+// the linter, built for the current platform. If signKey is set, the manifest
+// is signed with it. If tamper is also set, the manifest is altered after
+// signing.
+func writeTestArchive(t *testing.T, archivePath string, lntr *linter, signKey string, tamper bool) {
+	t.Helper()
+	sum, err := readerSHA256(strings.NewReader(testToolData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := archivePlatform{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH}
+	tool := archiveTool{
+		Name:      lntr.Name(),
+		File:      platform.dir() + "/" + exeName(lntr.cmd, runtime.GOOS),
+		Module:    "golang.org/x/tools",
+		Version:   lntr.version,
+		GoVersion: runtime.Version(),
+		SHA256:    sum,
+	}
+	platform.Tools = []archiveTool{tool}
+	data, err := json.MarshalIndent(&archiveManifest{Platforms: []archivePlatform{platform}}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig []byte
+	if signKey != "" {
+		key, kerr := loadPrivateKey(signKey)
+		if kerr != nil {
+			t.Fatal(kerr)
+		}
+		sig = signManifest(key, data)
+	}
+	if tamper {
+		data = []byte(strings.Replace(string(data), runtime.Version(), "go0.0.0", 1))
+	}
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw, err := newArchiveWriter(ZipFormat, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = addDataToArchive(aw, tool.File, []byte(testToolData)); err != nil {
+		t.Fatal(err)
+	}
+	if err = addDataToArchive(aw, manifestName, data); err != nil {
+		t.Fatal(err)
+	}
+	if sig != nil {
+		if err = addDataToArchive(aw, signatureName, sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// linterStats holds the resources consumed by a single linter run.
+type linterStats struct {
+	Name string `json:"name"`
+	// Shards is the number of processes the linter was split across with
+	// --shards. The times are summed across them, while MaxRSS is the largest
+	// of them and ExitStatus is the first non-zero one.
+	Shards      int     `json:"shards"`
+	WallSeconds float64 `json:"wall_seconds"`
+	UserSeconds float64 `json:"user_seconds"`
+	SysSeconds  float64 `json:"sys_seconds"`
+	// MaxRSS is the peak resident set size in bytes, sampled while the
+	// linter runs, which is only available on Linux.
+	MaxRSS   int64 `json:"max_rss_bytes,omitempty"`
+	Findings int   `json:"findings"`
+	// ExitStatus is the exit status of the linter's process, or -1 if it was
+	// terminated by a signal or could not be started.
+	ExitStatus int `json:"exit_status"`
+	// BuiltIn is true for checks that run within dirt, for which no CPU or
+	// memory usage is available.
+	BuiltIn bool `json:"built_in,omitempty"`
+	// Covers lists the linters run together within the in-process analysis
+	// pass, whose findings are counted towards it.
+	Covers []string `json:"covers,omitempty"`
+}
+
+// statsTotals holds the aggregate resources consumed across a run.
+type statsTotals struct {
+	WallSeconds   float64 `json:"wall_seconds"`
+	LinterSeconds float64 `json:"linter_seconds"`
+	UserSeconds   float64 `json:"user_seconds"`
+	SysSeconds    float64 `json:"sys_seconds"`
+	Findings      int     `json:"findings"`
+	Workers       int     `json:"workers"`
+	// Efficiency is the fraction of the available worker time spent running
+	// linters.
+	Efficiency float64 `json:"parallel_efficiency"`
+}
+
+// runStats holds the statistics gathered with --stats or --stats-json.
+type runStats struct {
+	Linters []*linterStats `json:"linters"`
+	Totals  statsTotals    `json:"totals"`
+}
+
+// collectingStats returns true if statistics should be gathered.
+func (l *lint) collectingStats() bool {
+	return !l.dryRun && (l.stats || l.statsJSON != "")
+}
+
+// startStats returns a new statistics entry for the named linter, or nil if
+// statistics aren't being gathered. The entry is added to the run's statistics
+// by finishStats.
+func (l *lint) startStats(name string) *linterStats {
+	if !l.collectingStats() {
+		return nil
+	}
+	return &linterStats{Name: name}
+}
+
+// timeBuiltIn calls fn, which performs a check within dirt, recording a
+// statistics entry with the name for it.
+func (l *lint) timeBuiltIn(name string, covers []string, fn func()) {
+	s := l.startStats(name)
+	if s == nil {
+		fn()
+		return
+	}
+	s.BuiltIn = true
+	s.Covers = covers
+	start := time.Now()
+	fn()
+	s.WallSeconds = time.Since(start).Seconds()
+	l.finishStats(s)
+}
+
+// finishStats adds the entry to the run's statistics, combining it with those
+// of the linter's other shards, if any.
+func (l *lint) finishStats(s *linterStats) {
+	if s == nil {
+		return
+	}
+	l.statsLock.Lock()
+	defer l.statsLock.Unlock()
+	for _, one := range l.linterStats {
+		if one.Name == s.Name {
+			one.Shards++
+			one.WallSeconds += s.WallSeconds
+			one.UserSeconds += s.UserSeconds
+			one.SysSeconds += s.SysSeconds
+			if s.MaxRSS > one.MaxRSS {
+				one.MaxRSS = s.MaxRSS
+			}
+			if one.ExitStatus == 0 {
+				one.ExitStatus = s.ExitStatus
+			}
+			return
+		}
+	}
+	s.Shards = 1
+	l.linterStats = append(l.linterStats, s)
+}
+
+// recordProcess records the resources consumed by the linter's process,
+// including its peak resident set size in bytes, if known.
+func (s *linterStats) recordProcess(state *os.ProcessState, peakRSS int64) {
+	if s == nil {
+		return
+	}
+	if state == nil {
+		s.ExitStatus = -1
+		return
+	}
+	s.UserSeconds = state.UserTime().Seconds()
+	s.SysSeconds = state.SystemTime().Seconds()
+	s.MaxRSS = peakRSS
+	s.ExitStatus = state.ExitCode()
+}
+
+// reportStats completes the statistics for a run that took elapsed time and
+// writes them out as requested.
+func (l *lint) reportStats(elapsed time.Duration, workers int) error {
+	if !l.collectingStats() {
+		return nil
+	}
+	rs := &runStats{Linters: l.linterStats}
+	sort.SliceStable(rs.Linters, func(i, j int) bool { return rs.Linters[i].WallSeconds > rs.Linters[j].WallSeconds })
+	t := &rs.Totals
+	t.WallSeconds = elapsed.Seconds()
+	t.Workers = workers
+	for _, one := range rs.Linters {
+		one.Findings = l.findings[one.Name]
+		for _, name := range one.Covers {
+			one.Findings += l.findings[name]
+		}
+		t.LinterSeconds += one.WallSeconds
+		t.UserSeconds += one.UserSeconds
+		t.SysSeconds += one.SysSeconds
+	}
+	for _, count := range l.findings {
+		t.Findings += count
+	}
+	if t.WallSeconds > 0 {
+		t.Efficiency = t.LinterSeconds / (t.WallSeconds * float64(workers))
+	}
+	if l.stats {
+		rs.print()
+	}
+	if l.statsJSON != "" {
+		data, err := json.MarshalIndent(rs, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(l.statsJSON, append(data, '\n'), 0644)
+	}
+	return nil
+}
+
+func (rs *runStats) print() {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINTER\tSHARDS\tWALL\tUSER\tSYS\tMAX RSS\tFINDINGS\tEXIT\t")
+	for _, one := range rs.Linters {
+		if one.BuiltIn {
+			name := one.Name
+			if len(one.Covers) > 0 {
+				name = fmt.Sprintf("%s (%s)", name, strings.Join(one.Covers, ", "))
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%.2fs\t-\t-\t-\t%d\t-\t\n", name, one.Shards, one.WallSeconds, one.Findings)
+			continue
+		}
+		rss := "-"
+		if one.MaxRSS > 0 {
+			rss = fmt.Sprintf("%.1f MiB", float64(one.MaxRSS)/(1024*1024))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.2fs\t%.2fs\t%.2fs\t%s\t%d\t%d\t\n", one.Name, one.Shards, one.WallSeconds, one.UserSeconds, one.SysSeconds, rss, one.Findings, one.ExitStatus)
+	}
+	t := &rs.Totals
+	fmt.Fprintf(tw, "TOTAL\t\t%.2fs\t%.2fs\t%.2fs\t\t%d\t\t\n", t.LinterSeconds, t.UserSeconds, t.SysSeconds, t.Findings)
+	tw.Flush() // @allow
+	fmt.Fprintf(os.Stderr, "Elapsed %.2fs with %d worker(s), for a parallel efficiency of %.0f%%\n", t.WallSeconds, t.Workers, t.Efficiency*100)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio/fs"
+)
+
+const tidyPrefix = "tidy"
+
+// checkTidy runs "go mod tidy" against copies of go.mod and go.sum and
+// reports the lines that would change.
+func (l *lint) checkTidy(ctx context.Context) {
+	modPath := l.goModPath()
+	if !fs.FileExists(modPath) {
+		return
+	}
+	sumPath := filepath.Join(l.repoPath, "go.sum")
+	tmpDir, err := ioutil.TempDir("", cmdline.AppCmdName)
+	if err != nil {
+		l.tidyError(err)
+		return
+	}
+	defer os.RemoveAll(tmpDir) // @allow
+	tmpModPath := filepath.Join(tmpDir, "go.mod")
+	tmpSumPath := filepath.Join(tmpDir, "go.sum")
+	if err = fs.Copy(modPath, tmpModPath); err != nil {
+		l.tidyError(err)
+		return
+	}
+	if fs.FileExists(sumPath) {
+		if err = fs.Copy(sumPath, tmpSumPath); err != nil {
+			l.tidyError(err)
+			return
+		}
+	}
+	cmd := exec.CommandContext(ctx, "go", "mod", "tidy", "-modfile="+tmpModPath)
+	cmd.Dir = l.repoPath
+	// Only the module cache is consulted, so that the check never waits on
+	// the network
+	cmd.Env = append(goEnv("-mod=mod"), "GOPROXY=off")
+	var out []byte
+	if out, err = cmd.CombinedOutput(); err != nil {
+		if bytes.Contains(out, []byte("GOPROXY=off")) {
+			// A module is missing from the module cache, which says nothing
+			// about whether go.mod is tidy
+			l.toolFailed(tidyPrefix, fmt.Sprintf("could not run, as a module is missing from the module cache: %s", bytes.TrimSpace(out)))
+			return
+		}
+		l.tidyError(fmt.Errorf("go mod tidy failed: %s", bytes.TrimSpace(out)))
+		return
+	}
+	origMod, err := ioutil.ReadFile(modPath)
+	if err != nil {
+		l.tidyError(err)
+		return
+	}
+	tidyMod, err := ioutil.ReadFile(tmpModPath)
+	if err != nil {
+		l.tidyError(err)
+		return
+	}
+	origSum, _ := ioutil.ReadFile(sumPath)    // @allow
+	tidySum, _ := ioutil.ReadFile(tmpSumPath) // @allow
+	modChanged := !bytes.Equal(origMod, tidyMod)
+	sumChanged := !bytes.Equal(origSum, tidySum)
+	if !modChanged && !sumChanged {
+		return
+	}
+	if l.fix {
+		if modChanged {
+			if err = fs.Copy(tmpModPath, modPath); err != nil {
+				l.tidyError(err)
+				return
+			}
+		}
+		if sumChanged {
+			if err = fs.Copy(tmpSumPath, sumPath); err != nil {
+				l.tidyError(err)
+				return
+			}
+		}
+		fmt.Println("Applied go mod tidy")
+		return
+	}
+	for _, edit := range diffLines(splitLines(origMod), splitLines(tidyMod)) {
+		action := "remove"
+		if edit.add {
+			action = "add"
+		}
+		text := strings.TrimSpace(edit.text)
+		if text == "" {
+			text = "(blank line)"
+		}
+		l.lineChan <- problem{prefix: tidyPrefix, output: fmt.Sprintf("%s:%d:1: Not tidy, go mod tidy would %s: %s", modPath, edit.line, action, text)}
+	}
+	if sumChanged {
+		l.lineChan <- problem{prefix: tidyPrefix, output: fmt.Sprintf("%s:1:1: Not tidy, go mod tidy would update go.sum", sumPath)}
+	}
+	l.markError()
+}
+
+func (l *lint) tidyError(err error) {
+	l.lineChan <- problem{prefix: tidyPrefix, output: fmt.Sprintf("%s:1:1: %v", l.goModPath(), err)}
+	l.markError()
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+type lineEdit struct {
+	line int
+	text string
+	add  bool
+}
+
+// diffLines returns the edits required to turn a into b. The line of each
+// edit refers to a, with additions positioned at the line they would be
+// inserted before, or the last line when appended to the end.
+func diffLines(a, b []string) []lineEdit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	insertLine := func(i int) int {
+		if i >= len(a) && i > 0 {
+			return len(a)
+		}
+		return i + 1
+	}
+	var edits []lineEdit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			edits = append(edits, lineEdit{line: insertLine(i), text: b[j], add: true})
+			j++
+		default:
+			edits = append(edits, lineEdit{line: i + 1, text: a[i]})
+			i++
+		}
+	}
+	return edits
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// toolchain holds information about the active go toolchain, as reported by
+// "go env" and "go version". Since these are obtained by running the go
+// command, GOTOOLCHAIN selection has already been applied.
+type toolchain struct {
+	Version     string `json:"GOVERSION"`
+	GOROOT      string `json:"GOROOT"`
+	GOPATH      string `json:"GOPATH"`
+	GOBIN       string `json:"GOBIN"`
+	GOMODCACHE  string `json:"GOMODCACHE"`
+	GOFLAGS     string `json:"GOFLAGS"`
+	GOTOOLCHAIN string `json:"GOTOOLCHAIN"`
+	GOOS        string `json:"GOOS"`
+	GOARCH      string `json:"GOARCH"`
+	err         error
+}
+
+var (
+	toolchainOnce sync.Once
+	activeTC      toolchain
+)
+
+// activeToolchain returns information about the go toolchain found on the
+// PATH.
+func activeToolchain() *toolchain {
+	toolchainOnce.Do(func() {
+		out, err := exec.Command("go", "env", "-json").Output()
+		if err != nil {
+			activeTC.err = fmt.Errorf("Unable to query the go toolchain: %v", err)
+			return
+		}
+		if err = json.Unmarshal(out, &activeTC); err != nil {
+			activeTC.err = fmt.Errorf("Unable to parse the output of go env: %v", err)
+			return
+		}
+		if activeTC.Version == "" {
+			// Toolchains prior to go1.16 don't report GOVERSION
+			if out, err = exec.Command("go", "version").Output(); err == nil {
+				if fields := strings.Fields(string(out)); len(fields) > 2 {
+					activeTC.Version = fields[2]
+				}
+			}
+		}
+		if activeTC.GOPATH == "" {
+			if dir, err := homedir.Dir(); err == nil {
+				activeTC.GOPATH = filepath.Join(dir, "go")
+			}
+		}
+		if activeTC.GOMODCACHE == "" && activeTC.GOPATH != "" {
+			activeTC.GOMODCACHE = filepath.Join(filepath.SplitList(activeTC.GOPATH)[0], "pkg", "mod")
+		}
+	})
+	return &activeTC
+}
+
+// goVersion returns the version of the go toolchain found on the PATH, e.g.
+// "go1.12.5", or "unknown" if it cannot be determined.
+func goVersion() string {
+	if v := activeToolchain().Version; v != "" {
+		return v
+	}
+	return "unknown"
+}
+
+// toolchainBefore returns true if the go toolchain is known to be older than
+// the specified version, e.g. "1.12".
+func toolchainBefore(version string) bool {
+	v := goVersion()
+	if version == "" || !strings.HasPrefix(v, "go") {
+		return false
+	}
+	return compareSemver(strings.SplitN(v[2:], " ", 2)[0], version) < 0
+}
+
+// binDir returns the directory go install places binaries into, honoring
+// GOBIN.
+func (tc *toolchain) binDir() (string, error) {
+	if tc.GOBIN != "" {
+		return tc.GOBIN, nil
+	}
+	if tc.GOPATH == "" {
+		return "", fmt.Errorf("Unable to determine GOPATH")
+	}
+	return filepath.Join(filepath.SplitList(tc.GOPATH)[0], "bin"), nil
+}
+
+// supportsModuleInstall returns true if the toolchain can install a specific
+// version of a command with "go install pkg@version".
+func (tc *toolchain) supportsModuleInstall() bool {
+	return !toolchainBefore("1.16")
+}
+
+// goEnv returns the environment to use when running the go command, with the
+// specified flags merged into the user's GOFLAGS. Any existing -mod flag is
+// dropped, since it either conflicts with a -mod flag being added or, as with
+// -mod=vendor for "go install pkg@version", may be rejected by a command that
+// doesn't operate on the main module.
+func goEnv(extraFlags ...string) []string {
+	var flags []string
+	for _, one := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if !strings.HasPrefix(one, "-mod=") {
+			flags = append(flags, one)
+		}
+	}
+	flags = append(flags, extraFlags...)
+	return append(os.Environ(), "GOFLAGS="+strings.Join(flags, " "))
+}
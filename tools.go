@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nightlyone/lockfile"
+	"github.com/richardwilkes/toolbox/cmdline"
+	"github.com/richardwilkes/toolbox/xio/fs"
+	"github.com/richardwilkes/toolbox/xio/fs/safe"
+	"golang.org/x/mod/modfile"
+	modmodule "golang.org/x/mod/module"
+)
+
+// projectsFile is the name of the file within the tools directory that records
+// the linter versions each project uses.
+const projectsFile = "projects.json"
+
+// projectsLockFile is the name of the lock file guarding changes to the
+// projects file.
+const projectsLockFile = "projects.lock"
+
+// toolsDir returns the directory holding dirt's cache of versioned linter
+// binaries, e.g. $XDG_CACHE_HOME/dirt/tools.
+func toolsDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cmdline.AppCmdName, "tools"), nil
+}
+
+// toolName returns the name of the linter's directory within the tools
+// directory, which is keyed by its version.
+func (lntr *linter) toolName() string {
+	return lntr.cmd + "@" + lntr.version
+}
+
+// toolDir returns the dirt-managed directory a pinned linter is installed
+// into.
+func (lntr *linter) toolDir() (string, error) {
+	dir, err := toolsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, lntr.toolName()), nil
+}
+
+// usePinnedVersions adjusts the version pins in Linters to match the project
+// rooted at root. Any linter whose package is named by a tool directive in
+// the project's go.mod uses the version of the module providing it that the
+// go.mod requires. Since that version may need a different toolchain than the
+// default pin, the linter's minimum go version is then taken from the
+// module's own go.mod, if it is present in the module cache.
+func usePinnedVersions(root string) error {
+	data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	// Lax parsing ignores tool directives
+	f, err := modfile.Parse("go.mod", data, nil)
+	if err != nil {
+		return err
+	}
+	tools := make(map[string]bool)
+	for _, one := range f.Tool {
+		tools[one.Path] = true
+	}
+	for i := range Linters {
+		one := &Linters[i]
+		if one.version == "" || !tools[one.pkg] {
+			continue
+		}
+		var best *modfile.Require
+		for _, req := range f.Require {
+			if (best == nil || len(req.Mod.Path) > len(best.Mod.Path)) && (one.pkg == req.Mod.Path || strings.HasPrefix(one.pkg, req.Mod.Path+"/")) {
+				best = req
+			}
+		}
+		if best != nil && best.Mod.Version != one.version {
+			one.version = best.Mod.Version
+			one.minGo = moduleGoVersion(best.Mod.Path, best.Mod.Version)
+		}
+	}
+	return nil
+}
+
+// moduleGoVersion returns the go version declared by the go.mod of the
+// specified module version, as found in the module cache, or an empty string
+// if it isn't available.
+func moduleGoVersion(modPath, version string) string {
+	escPath, err := modmodule.EscapePath(modPath)
+	if err != nil {
+		return ""
+	}
+	escVersion, err := modmodule.EscapeVersion(version)
+	if err != nil {
+		return ""
+	}
+	p := filepath.Join(activeToolchain().GOMODCACHE, "cache", "download", filepath.FromSlash(escPath), "@v", escVersion+".mod")
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+	f, err := modfile.ParseLax(p, data, nil)
+	if err != nil || f.Go == nil {
+		return ""
+	}
+	return f.Go.Version
+}
+
+// recordProjectTools records the pinned linter versions used by the project
+// rooted at root, so that they are kept by a later garbage collection of the
+// tools directory.
+func recordProjectTools(root string) error {
+	dir, err := toolsDir()
+	if err != nil {
+		return err
+	}
+	var tools []string
+	for i := range Linters {
+		if Linters[i].version != "" {
+			tools = append(tools, Linters[i].toolName())
+		}
+	}
+	return updateProjectTools(dir, func(projects map[string][]string) (bool, error) {
+		if strings.Join(projects[root], " ") == strings.Join(tools, " ") {
+			return false, nil
+		}
+		projects[root] = tools
+		return true, nil
+	})
+}
+
+// updateProjectTools calls update with the tools each project uses while
+// holding a lock on the record, saving the record if update returns true.
+func updateProjectTools(dir string, update func(projects map[string][]string) (bool, error)) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	lf, err := lockfile.New(filepath.Join(dir, projectsLockFile))
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err = lf.TryLock(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Unable to lock %s: %v", filepath.Join(dir, projectsLockFile), err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer lf.Unlock() // @allow
+	projects, err := loadProjectTools(dir)
+	if err != nil {
+		return err
+	}
+	changed, err := update(projects)
+	if err != nil || !changed {
+		return err
+	}
+	return saveProjectTools(dir, projects)
+}
+
+// loadProjectTools returns the tools each project uses, keyed by the project
+// root, as recorded within dir.
+func loadProjectTools(dir string) (map[string][]string, error) {
+	projects := make(map[string][]string)
+	data, err := ioutil.ReadFile(filepath.Join(dir, projectsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return projects, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &projects); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %v", filepath.Join(dir, projectsFile), err)
+	}
+	return projects, nil
+}
+
+func saveProjectTools(dir string, projects map[string][]string) (err error) {
+	data, err := json.MarshalIndent(projects, "", "  ")
+	if err != nil {
+		return err
+	}
+	var f *safe.File
+	if f, err = safe.Create(filepath.Join(dir, projectsFile)); err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+type gcCmd struct {
+	dryRun bool
+}
+
+// Name implements the cmdline.Cmd interface.
+func (c *gcCmd) Name() string {
+	return "gc"
+}
+
+// Usage implements the cmdline.Cmd interface.
+func (c *gcCmd) Usage() string {
+	return "Remove the cached linter versions that no project references any more."
+}
+
+// Run implements the cmdline.Cmd interface.
+func (c *gcCmd) Run(cl *cmdline.CmdLine, args []string) error {
+	cl.NewBoolOption(&c.dryRun).SetSingle('n').SetName("dry-run").SetUsage("When set, just print the linter versions that would be removed")
+	cl.Parse(args)
+	dir, err := toolsDir()
+	if err != nil {
+		return err
+	}
+	if !fs.IsDir(dir) {
+		return nil
+	}
+	// The lock is held while removing, so that a concurrent run can't record
+	// and install a version that is about to be removed.
+	return updateProjectTools(dir, func(projects map[string][]string) (bool, error) {
+		keep := make(map[string]bool)
+		forgotten := false
+		for root, tools := range projects {
+			if !fs.IsDir(root) {
+				delete(projects, root)
+				forgotten = true
+				continue
+			}
+			for _, one := range tools {
+				keep[one] = true
+			}
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return false, err
+		}
+		var remove []string
+		for _, one := range entries {
+			if one.IsDir() && !keep[one.Name()] {
+				remove = append(remove, one.Name())
+			}
+		}
+		sort.Strings(remove)
+		for _, one := range remove {
+			if c.dryRun {
+				fmt.Println("Would remove", one)
+				continue
+			}
+			if err = os.RemoveAll(filepath.Join(dir, one)); err != nil {
+				return false, err
+			}
+			fmt.Println("Removed", one)
+		}
+		return forgotten && !c.dryRun, nil
+	})
+}
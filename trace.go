@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/richardwilkes/toolbox/atexit"
+)
+
+// runTrace records the timeline of the run when --trace is set, and is nil
+// otherwise.
+var runTrace *tracer
+
+// traceEvent is an event in the Chrome trace event format, which can be loaded
+// into chrome://tracing or Perfetto.
+type traceEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Phase string                 `json:"ph"`
+	TS    int64                  `json:"ts"`
+	Dur   int64                  `json:"dur,omitempty"`
+	PID   int                    `json:"pid"`
+	TID   int                    `json:"tid"`
+	Scope string                 `json:"s,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// tracer collects trace events. Lane 0 is the main goroutine, while lanes 1
+// and up are handed out to the linters as they run, each taking the lowest
+// lane free when it starts. The lanes in use at any moment therefore show how
+// many linters were running at once, but a lane isn't tied to a particular
+// worker. All methods may be called on a nil tracer, which records nothing.
+type tracer struct {
+	lock    sync.Mutex
+	start   time.Time
+	events  []traceEvent
+	lanes   []bool
+	maxLane int
+}
+
+// traceSpan is an event with a duration that is still in progress.
+type traceSpan struct {
+	t     *tracer
+	name  string
+	cat   string
+	lane  int
+	start time.Time
+	args  map[string]interface{}
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+// acquireLane returns the lowest lane not currently in use by another linter.
+func (t *tracer) acquireLane() int {
+	if t == nil {
+		return 0
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i, used := range t.lanes {
+		if !used {
+			t.lanes[i] = true
+			return i + 1
+		}
+	}
+	t.lanes = append(t.lanes, true)
+	if len(t.lanes) > t.maxLane {
+		t.maxLane = len(t.lanes)
+	}
+	return len(t.lanes)
+}
+
+// releaseLane makes the lane available to the next linter.
+func (t *tracer) releaseLane(lane int) {
+	if t == nil || lane < 1 {
+		return
+	}
+	t.lock.Lock()
+	t.lanes[lane-1] = false
+	t.lock.Unlock()
+}
+
+// begin starts a span on the lane, which is recorded once end is called.
+func (t *tracer) begin(name, cat string, lane int) *traceSpan {
+	if t == nil {
+		return nil
+	}
+	return &traceSpan{t: t, name: name, cat: cat, lane: lane, start: time.Now()}
+}
+
+// arg attaches a value to the span.
+func (s *traceSpan) arg(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if s.args == nil {
+		s.args = make(map[string]interface{})
+	}
+	s.args[key] = value
+}
+
+// end records the span.
+func (s *traceSpan) end() {
+	if s == nil {
+		return
+	}
+	s.t.add(traceEvent{
+		Name:  s.name,
+		Cat:   s.cat,
+		Phase: "X",
+		TS:    s.t.micros(s.start),
+		Dur:   int64(time.Since(s.start) / time.Microsecond),
+		TID:   s.lane,
+		Args:  s.args,
+	})
+}
+
+// instant records a point in time on the lane, such as a timeout.
+func (t *tracer) instant(name, cat string, lane int, args map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	t.add(traceEvent{
+		Name:  name,
+		Cat:   cat,
+		Phase: "i",
+		TS:    t.micros(time.Now()),
+		TID:   lane,
+		Scope: "t",
+		Args:  args,
+	})
+}
+
+func (t *tracer) micros(when time.Time) int64 {
+	return int64(when.Sub(t.start) / time.Microsecond)
+}
+
+func (t *tracer) add(event traceEvent) {
+	event.PID = 1
+	t.lock.Lock()
+	t.events = append(t.events, event)
+	t.lock.Unlock()
+}
+
+// write saves the trace to the file at path.
+func (t *tracer) write(path string) error {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	events := make([]traceEvent, 0, len(t.events)+t.maxLane+2)
+	events = append(events, traceEvent{Name: "process_name", Phase: "M", PID: 1, Args: map[string]interface{}{"name": "dirt"}})
+	for lane := 0; lane <= t.maxLane; lane++ {
+		name := "main"
+		if lane > 0 {
+			name = fmt.Sprintf("lane %d", lane)
+		}
+		events = append(events, traceEvent{Name: "thread_name", Phase: "M", PID: 1, TID: lane, Args: map[string]interface{}{"name": name}})
+	}
+	events = append(events, t.events...)
+	data, err := json.Marshal(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// startTrace begins recording a trace that is written to path when dirt exits.
+func startTrace(path string) {
+	runTrace = newTracer()
+	atexit.Register(func() {
+		if err := runTrace.write(path); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to write the trace:", err)
+		}
+	})
+}
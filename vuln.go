@@ -0,0 +1,353 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/richardwilkes/toolbox/xio"
+	"github.com/richardwilkes/toolbox/xio/fs"
+)
+
+const vulnPrefix = "vuln"
+
+type osvEntry struct {
+	ID        string        `json:"id"`
+	Aliases   []string      `json:"aliases"`
+	Summary   string        `json:"summary"`
+	Withdrawn string        `json:"withdrawn"`
+	Affected  []osvAffected `json:"affected"`
+}
+
+// osvDB holds OSV entries, keyed by the Go module path they affect.
+type osvDB map[string][]*osvEntry
+
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges            []osvRange `json:"ranges"`
+	EcosystemSpecific struct {
+		Imports []osvImport `json:"imports"`
+	} `json:"ecosystem_specific"`
+}
+
+type osvRange struct {
+	Type   string     `json:"type"`
+	Events []osvEvent `json:"events"`
+}
+
+type osvEvent struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"last_affected"`
+}
+
+type osvImport struct {
+	Path    string   `json:"path"`
+	Symbols []string `json:"symbols"`
+}
+
+type sourceFile struct {
+	fset    *token.FileSet
+	imports map[string]sourceImport
+	calls   []sourceCall
+}
+
+type sourceImport struct {
+	name string
+	pos  token.Pos
+}
+
+type sourceCall struct {
+	qualifier string
+	name      string
+	pos       token.Pos
+}
+
+func (l *lint) checkVulnerabilities() {
+	db, err := loadVulnDB(l.vulnDBPath)
+	if err == nil {
+		var modules []*module
+		if modules, err = listModules(); err == nil {
+			if l.reportVulnerabilities(db, modules, l.parseSourceFiles()) {
+				l.markError()
+			}
+			return
+		}
+	}
+	l.lineChan <- problem{prefix: vulnPrefix, output: fmt.Sprintf("%s: %v", l.goModPath(), err)}
+	l.markError()
+}
+
+func (l *lint) reportVulnerabilities(db osvDB, modules []*module, files []*sourceFile) bool {
+	hadIssue := false
+	for _, mod := range modules {
+		if mod.Main || mod.Version == "" {
+			continue
+		}
+		for _, entry := range db[mod.Path] {
+			for i := range entry.Affected {
+				affected := &entry.Affected[i]
+				if affected.Package.Name != mod.Path || !affected.affects(mod.Version) {
+					continue
+				}
+				desc := entry.describe(affected.fixedAfter(mod.Version))
+				var sites []string
+				for _, f := range files {
+					for _, imp := range affected.EcosystemSpecific.Imports {
+						for _, pos := range f.uses(imp) {
+							sites = append(sites, fmt.Sprintf("%v: Use of %s is affected by %s", f.fset.Position(pos), imp.Path, desc))
+						}
+					}
+				}
+				if len(sites) == 0 && l.vulnCalledOnly && len(affected.EcosystemSpecific.Imports) > 0 {
+					break
+				}
+				hadIssue = true
+				l.lineChan <- problem{prefix: vulnPrefix, output: fmt.Sprintf("%s:%d:1: %s %s is affected by %s", l.goModPath(), l.goModLine(mod.Path), mod.Path, mod.Version, desc)}
+				for _, one := range sites {
+					l.lineChan <- problem{prefix: vulnPrefix, output: one}
+				}
+				break
+			}
+		}
+	}
+	return hadIssue
+}
+
+func (entry *osvEntry) describe(fixed string) string {
+	var buffer strings.Builder
+	buffer.WriteString(entry.ID)
+	if len(entry.Aliases) > 0 {
+		fmt.Fprintf(&buffer, " (%s)", strings.Join(entry.Aliases, ", "))
+	}
+	if entry.Summary != "" {
+		buffer.WriteString(": ")
+		buffer.WriteString(entry.Summary)
+	}
+	if fixed != "" {
+		buffer.WriteString("; fixed in ")
+		buffer.WriteString(fixed)
+	}
+	return buffer.String()
+}
+
+func (a *osvAffected) affects(version string) bool {
+	if len(a.Ranges) == 0 {
+		return true
+	}
+	for _, r := range a.Ranges {
+		if (r.Type == "SEMVER" || r.Type == "ECOSYSTEM") && r.affects(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedAfter returns the lowest fixed version greater than the specified
+// version, or an empty string if there is none.
+func (a *osvAffected) fixedAfter(version string) string {
+	var fixed string
+	for _, r := range a.Ranges {
+		for _, e := range r.Events {
+			if e.Fixed != "" && compareSemver(e.Fixed, version) > 0 && (fixed == "" || compareSemver(e.Fixed, fixed) < 0) {
+				fixed = e.Fixed
+			}
+		}
+	}
+	if fixed != "" && !strings.HasPrefix(fixed, "v") {
+		fixed = "v" + fixed
+	}
+	return fixed
+}
+
+func (r *osvRange) affects(version string) bool {
+	events := make([]osvEvent, len(r.Events))
+	copy(events, r.Events)
+	sort.SliceStable(events, func(i, j int) bool {
+		return compareSemver(events[i].version(), events[j].version()) < 0
+	})
+	affected := false
+	for _, e := range events {
+		switch {
+		case e.Introduced != "":
+			if e.Introduced == "0" || compareSemver(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case e.Fixed != "":
+			if compareSemver(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case e.LastAffected != "":
+			if compareSemver(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		}
+	}
+	return affected
+}
+
+func (e osvEvent) version() string {
+	switch {
+	case e.Introduced != "":
+		return e.Introduced
+	case e.Fixed != "":
+		return e.Fixed
+	default:
+		return e.LastAffected
+	}
+}
+
+// loadVulnDB loads the OSV entries from either a directory tree or a zip
+// file.
+func loadVulnDB(dbPath string) (osvDB, error) {
+	db := make(osvDB)
+	if fs.IsDir(dbPath) {
+		err := filepath.Walk(dbPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(p, ".json") {
+				var data []byte
+				if data, err = ioutil.ReadFile(p); err != nil {
+					return err
+				}
+				db.add(data)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	zr, err := zip.OpenReader(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer xio.CloseIgnoringErrors(zr)
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, ".json") {
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(r)
+			xio.CloseIgnoringErrors(r)
+			if err != nil {
+				return nil, err
+			}
+			db.add(data)
+		}
+	}
+	return db, nil
+}
+
+// add decodes an OSV entry and adds it to the database. Files that aren't
+// OSV entries, such as the indexes found in the Go vulnerability database,
+// as well as withdrawn entries, are ignored.
+func (db osvDB) add(data []byte) {
+	var entry osvEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.ID == "" || entry.Withdrawn != "" {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, one := range entry.Affected {
+		if one.Package.Ecosystem == "Go" && !seen[one.Package.Name] {
+			seen[one.Package.Name] = true
+			db[one.Package.Name] = append(db[one.Package.Name], &entry)
+		}
+	}
+}
+
+func (l *lint) parseSourceFiles() []*sourceFile {
+	result := make([]*sourceFile, 0, len(l.files))
+	for _, one := range l.files {
+		sf := &sourceFile{fset: token.NewFileSet(), imports: make(map[string]sourceImport)}
+		f, err := parser.ParseFile(sf.fset, one, nil, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		for _, imp := range f.Imports {
+			importPath, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || allowedOnLine(sf.fset, f, imp.Pos()) {
+				continue
+			}
+			name := importName(importPath)
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			sf.imports[importPath] = sourceImport{name: name, pos: imp.Pos()}
+		}
+		inspectCalls(f, func(name string, pos token.Pos) {
+			if allowedOnLine(sf.fset, f, pos) {
+				return
+			}
+			call := sourceCall{name: name, pos: pos}
+			if i := strings.LastIndexByte(name, '.'); i != -1 {
+				call.qualifier = name[:i]
+				call.name = name[i+1:]
+			}
+			sf.calls = append(sf.calls, call)
+		})
+		result = append(result, sf)
+	}
+	return result
+}
+
+// uses returns the positions within the file that make use of the affected
+// import. When the import lists specific symbols, only calls to those symbols
+// are returned. Since no type information is available, methods are matched
+// by name against any call that isn't qualified by a package name.
+func (sf *sourceFile) uses(imp osvImport) []token.Pos {
+	si, ok := sf.imports[imp.Path]
+	if !ok {
+		return nil
+	}
+	if len(imp.Symbols) == 0 {
+		return []token.Pos{si.pos}
+	}
+	packageNames := make(map[string]bool)
+	for _, one := range sf.imports {
+		packageNames[one.name] = true
+	}
+	var result []token.Pos
+	for _, call := range sf.calls {
+		for _, symbol := range imp.Symbols {
+			if i := strings.IndexByte(symbol, '.'); i != -1 {
+				if call.name == symbol[i+1:] && call.qualifier != "" && !packageNames[call.qualifier] {
+					result = append(result, call.pos)
+					break
+				}
+			} else if call.name == symbol && call.qualifier == si.name {
+				result = append(result, call.pos)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// importName returns the package name that is most likely to be used for the
+// import path, skipping any major version suffix.
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(importPath))
+	}
+	if i := strings.IndexByte(name, '.'); i != -1 {
+		name = name[:i]
+	}
+	return strings.Replace(name, "-", "_", -1)
+}